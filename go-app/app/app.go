@@ -4,9 +4,14 @@ import (
 	"context"
 	"github.com/kamva/mgm/v3"
 	"go-app/configs"
+	"go-app/definitions/users"
+	"go-app/importer"
+	"go-app/mediagc"
+	"go-app/mediaurls"
 	"go-app/middlewares"
 	"go-app/repositories/moviesrepo"
 	"go-app/repositories/usersrepo"
+	"go-app/storage"
 	"log"
 	"net/http"
 
@@ -22,6 +27,22 @@ var (
 	r = gin.Default()
 )
 
+// ConnectDB connects to MongoDB and sets up the default mgm config
+func ConnectDB(config configs.Config) (*mongo.Client, error) {
+	// Set client options
+	clientOptions := options.Client().ApplyURI(config.MongoDB.URI) // use env variables
+	// Connect to MongoDB
+	mongoDB, err := mongo.Connect(context.Background(), clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	err = mgm.SetDefaultConfig(nil, "lw-netflix", clientOptions)
+	if err != nil {
+		return nil, err
+	}
+	return mongoDB, nil
+}
+
 // Run is the App Entry Point
 func Run() {
 
@@ -33,11 +54,7 @@ func Run() {
 	}
 	config := configs.GetConfig()
 
-	// Set client options
-	clientOptions := options.Client().ApplyURI(config.MongoDB.URI) // use env variables
-	// Connect to MongoDB
-	mongoDB, err := mongo.Connect(context.Background(), clientOptions)
-	err = mgm.SetDefaultConfig(nil, "lw-netflix", clientOptions)
+	mongoDB, err := ConnectDB(config)
 	if err != nil {
 		panic(err)
 	}
@@ -47,12 +64,43 @@ func Run() {
 	*/
 	userRepo := usersrepo.NewUsersRepo(mongoDB)
 	moviesRepo := moviesrepo.NewMoviesRepo(mongoDB)
+	// The app still serves requests when duplicates prevent creating an index, until they are removed
+	if err := moviesRepo.EnsureIndexes(); err != nil {
+		log.Println(err)
+	}
+
+	/*
+		====== Setup storage ============
+	*/
+	store, err := storage.New(config.Storage)
+	if err != nil {
+		panic(err)
+	}
+
+	/*
+		====== Setup media URLs =========
+	*/
+	signer, err := mediaurls.NewSigner(config.Media.URLSecret, config.Media.URLExpiry, userRepo)
+	if err != nil {
+		panic(err)
+	}
 
 	/*
 		====== Setup controllers ========
 	*/
-	userCtl := controllers.NewUserController(userRepo)
-	moviesCtl := controllers.NewMoviesController(moviesRepo, userRepo)
+	userCtl := controllers.NewUserController(userRepo, signer)
+	moviesCtl := controllers.NewMoviesController(moviesRepo, userRepo, config.Media, store, signer, config.Playback)
+	importsCtl := controllers.NewImportsController(importer.NewImporter(moviesRepo), config.Import)
+	uploadsCtl := controllers.NewUploadsController(moviesRepo, store, config.Media)
+	streamsCtl := controllers.NewStreamsController(moviesRepo, store, signer)
+
+	/*
+		====== Setup media GC ===========
+	*/
+	if config.Media.GCInterval > 0 {
+		gc := mediagc.NewCollector(moviesRepo, store, config.Media.GCGracePeriod, config.Media.UploadsDir, config.Media.UploadExpiry)
+		go gc.Sweep(context.Background(), config.Media.GCInterval)
+	}
 
 	/*
 		======== Routes ============
@@ -71,25 +119,100 @@ func Run() {
 
 	r.POST("/users/register/", userCtl.RegisterUser)
 	r.POST("/users/login/", userCtl.LoginUser)
-	movies := r.Group("/movies/")
+	r.PUT("/users/preferences/", middlewares.Authorize(), userCtl.UpdatePreferences)
+	r.POST("/users/media-urls/revoke/", middlewares.Authorize(), userCtl.RevokeMediaURLs)
+	movies := r.Group("/movies/").Use(middlewares.Authenticate())
 	{
 		movies.GET("", moviesCtl.ListMovies)
 		movies.GET("sort/:by/:direction/", moviesCtl.ListMovies)
+		movies.GET("export/", moviesCtl.ExportMovies)
+	}
+	imports := r.Group("/movies/import/").Use(middlewares.Authorize())
+	{
+		imports.POST("", importsCtl.StartImport)
+		imports.GET(":job/", importsCtl.GetImportJob)
+	}
+	continueWatching := r.Group("/movies/continue/").Use(middlewares.Authorize())
+	{
+		continueWatching.GET("", moviesCtl.ListContinueWatching)
+		continueWatching.DELETE(":id/", moviesCtl.DismissContinueWatching)
+	}
+	watchlist := r.Group("/movies/watchlist/").Use(middlewares.Authorize())
+	{
+		watchlist.GET("", moviesCtl.ListWatchlist)
+		watchlist.PUT("", moviesCtl.ReorderWatchlist)
+		watchlist.PUT(":id/", moviesCtl.AddToWatchlist)
+		watchlist.DELETE(":id/", moviesCtl.RemoveFromWatchlist)
 	}
 	watchedMovies := r.Group("/movies/watched/").Use(middlewares.Authorize())
 	{
 		watchedMovies.GET("", moviesCtl.ListWatchedMovies)
 	}
+	r.GET("/movie/cover/:id/", middlewares.AuthenticateMedia(signer), moviesCtl.ServeCover)
+	r.OPTIONS("/movie/video/uploads/", uploadsCtl.UploadOptions)
 	movie := r.Group("/movie/").Use(middlewares.Authorize())
 	{
 		movie.POST("add/", moviesCtl.AddMovie)
 		movie.GET("info/:id/", moviesCtl.GetMovieInfo)
 		movie.PUT("info/:id/", moviesCtl.UploadCover)
 		movie.POST("info/:id/", moviesCtl.UpdateMovie)
+		movie.PATCH("info/:id/", moviesCtl.PatchMovie)
 		movie.DELETE("info/:id/", moviesCtl.DeleteMovie)
+		movie.PUT("info/:id/translations/:lang/", moviesCtl.SetTranslation)
+		movie.DELETE("info/:id/translations/:lang/", moviesCtl.DeleteTranslation)
+		movie.GET("info/:id/collaborators/", moviesCtl.ListCollaborators)
+		movie.POST("info/:id/collaborators/", moviesCtl.AddCollaborator)
+		movie.DELETE("info/:id/collaborators/:user/", moviesCtl.RemoveCollaborator)
+		movie.POST("info/:id/transfer/", moviesCtl.TransferOwnership)
+		movie.POST("info/:id/submit/", moviesCtl.SubmitMovie)
+		movie.GET("info/:id/history/", moviesCtl.GetMovieHistory)
+		movie.POST("info/:id/revert/:rev/", moviesCtl.RevertMovie)
+		movie.POST("info/:id/video/", uploadsCtl.CreateUpload)
+		movie.HEAD("video/uploads/:upload/", uploadsCtl.GetUploadOffset)
+		movie.PATCH("video/uploads/:upload/", uploadsCtl.PatchUpload)
+		movie.DELETE("video/uploads/:upload/", uploadsCtl.DeleteUpload)
 		movie.GET("watch/:id/", moviesCtl.WatchMovie)
+		movie.PUT("watch/:id/progress/", moviesCtl.ReportProgress)
+		movie.PUT("info/:id/subtitles/:lang/", moviesCtl.UploadSubtitles)
+		movie.DELETE("info/:id/subtitles/:lang/", moviesCtl.DeleteSubtitles)
+		movie.PUT("info/:id/renditions/:rendition/", streamsCtl.SaveRendition)
+		movie.DELETE("info/:id/renditions/:rendition/", streamsCtl.DeleteRendition)
+		movie.PUT("info/:id/renditions/:rendition/segments/:segment", streamsCtl.UploadSegment)
 		movie.POST("review/:id/", moviesCtl.ReviewMovie)
 	}
+	stream := r.Group("/movie/stream/").Use(middlewares.AuthorizeMedia(signer))
+	{
+		stream.GET(":id/", moviesCtl.StreamMovie)
+		stream.HEAD(":id/", moviesCtl.StreamMovie)
+		stream.GET(":id/subtitles/:lang/", moviesCtl.ServeSubtitles)
+		stream.GET(":id/master.m3u8", streamsCtl.HLSMaster)
+		stream.GET(":id/manifest.mpd", streamsCtl.DASHManifest)
+		stream.GET(":id/renditions/:rendition/playlist.m3u8", streamsCtl.HLSPlaylist)
+		stream.GET(":id/renditions/:rendition/segments/:segment", streamsCtl.ServeSegment)
+	}
+	r.GET("/collections/public/", middlewares.Authenticate(), moviesCtl.ListPublicCollections)
+	r.GET("/collections/shared/:token/", middlewares.Authenticate(), moviesCtl.GetSharedCollection)
+	r.POST("/collections/shared/:token/copy/", middlewares.Authorize(), moviesCtl.CopySharedCollection)
+	r.GET("/collections/:id/", middlewares.Authenticate(), moviesCtl.GetCollection)
+	collections := r.Group("/collections/").Use(middlewares.Authorize())
+	{
+		collections.GET("", moviesCtl.ListCollections)
+		collections.POST("", moviesCtl.CreateCollection)
+		collections.PUT(":id/", moviesCtl.UpdateCollection)
+		collections.DELETE(":id/", moviesCtl.DeleteCollection)
+		collections.POST(":id/copy/", moviesCtl.CopyCollection)
+		collections.POST(":id/share-link/", moviesCtl.RotateShareLink)
+	}
+	moderation := r.Group("/moderation/").Use(middlewares.Authorize(), middlewares.RequireRole(users.RoleModerator))
+	{
+		moderation.GET("movies/", moviesCtl.ListModerationQueue)
+		moderation.POST("movies/:id/approve/", moviesCtl.ApproveMovie)
+		moderation.POST("movies/:id/reject/", moviesCtl.RejectMovie)
+	}
+	admin := r.Group("/admin/").Use(middlewares.Authorize(), middlewares.RequireRole(users.RoleAdmin))
+	{
+		admin.POST("movies/merge/", moviesCtl.MergeMovies)
+	}
 	err = r.Run()
 	if err != nil {
 		panic(err)
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"github.com/joho/godotenv"
+	"github.com/kamva/mgm/v3"
+	"go-app/app"
+	"go-app/configs"
+	"go-app/definitions/users"
+	"go-app/importer"
+	"go-app/repositories/moviesrepo"
+	"go.mongodb.org/mongo-driver/bson"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Imports movies from a CSV, JSON or NDJSON file, i.e.
+// go run ./cmd/import -file movies.csv -owner user@example.com -dry-run
+func main() {
+	file := flag.String("file", "", "path of the file to import")
+	format := flag.String("format", "", "csv, json or ndjson (defaults to the file extension)")
+	owner := flag.String("owner", "", "email of the user the movies are imported for")
+	dryRun := flag.Bool("dry-run", false, "validate the file without writing movies")
+	flag.Parse()
+
+	if *file == "" || *owner == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(*file)), ".")
+	}
+	if !importer.ValidFormat(*format) {
+		log.Fatalf("unsupported import format %q", *format)
+	}
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	mongoDB, err := app.ConnectDB(configs.GetConfig())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ownerUser := &users.User{}
+	if err := mgm.Coll(ownerUser).First(bson.M{"email": strings.ToLower(*owner)}, ownerUser); err != nil {
+		log.Fatalf("unable to find owner %s: %v", *owner, err)
+	}
+
+	input, err := os.Open(*file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer input.Close()
+
+	im := importer.NewImporter(moviesrepo.NewMoviesRepo(mongoDB))
+	job, err := im.CreateJob(*format, *dryRun, ownerUser)
+	if err != nil {
+		log.Fatal(err)
+	}
+	runErr := im.Run(job, input, ownerUser)
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(job); err != nil {
+		log.Fatal(err)
+	}
+	if runErr != nil || job.Failed > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"github.com/joho/godotenv"
+	"go-app/app"
+	"go-app/configs"
+	"go-app/mediagc"
+	"go-app/repositories/moviesrepo"
+	"go-app/storage"
+	"log"
+	"os"
+)
+
+// Reports orphaned and missing media files and expired uploads, and deletes orphans past
+// the grace period and expired uploads, i.e.
+// go run ./cmd/mediagc -dry-run
+func main() {
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	config := configs.GetConfig()
+
+	dryRun := flag.Bool("dry-run", false, "report orphans without deleting them")
+	grace := flag.Duration("grace", config.Media.GCGracePeriod, "minimum age of the orphans to delete")
+	uploadExpiry := flag.Duration("upload-expiry", config.Media.UploadExpiry, "how long uploads receiving no bytes are kept")
+	flag.Parse()
+
+	mongoDB, err := app.ConnectDB(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := storage.New(config.Storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	gc := mediagc.NewCollector(moviesrepo.NewMoviesRepo(mongoDB), store, *grace, config.Media.UploadsDir, *uploadExpiry)
+	report, err := gc.Run(context.Background(), *dryRun)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/joho/godotenv"
+	"github.com/kamva/mgm/v3"
+	"github.com/kamva/mgm/v3/operator"
+	"go-app/app"
+	"go-app/configs"
+	"go-app/definitions/movies"
+	"go-app/media"
+	"go-app/repositories/moviesrepo"
+	"go-app/storage"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Moves the covers stored as files in the former COVERS_DIR to the storage backend, under the
+// covers/ prefix, and updates the movies referencing them. Legacy files are left in place, so they
+// can be deleted once the migration succeeded, i.e.
+// go run ./cmd/migratecovers -dir /opt/go-app/covers -dry-run
+func main() {
+	dir := flag.String("dir", "/opt/go-app/covers", "directory the covers were stored in")
+	dryRun := flag.Bool("dry-run", false, "report the covers to migrate without moving them")
+	flag.Parse()
+
+	if err := godotenv.Load(); err != nil {
+		log.Fatal("Error loading .env file")
+	}
+	config := configs.GetConfig()
+	mongoDB, err := app.ConnectDB(config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	store, err := storage.New(config.Storage)
+	if err != nil {
+		log.Fatal(err)
+	}
+	mr := moviesrepo.NewMoviesRepo(mongoDB)
+
+	legacy := []movies.Movie{}
+	err = mgm.Coll(&movies.Movie{}).SimpleFind(&legacy, bson.M{"cover.key": bson.M{
+		operator.Exists: true,
+		operator.Not:    primitive.Regex{Pattern: "^" + storage.CoversPrefix},
+	}})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	migrated, failed := 0, 0
+	for i := range legacy {
+		movie := &legacy[i]
+		if err := migrateCover(context.Background(), mr, store, *dir, movie, *dryRun); err != nil {
+			log.Printf("movie %s: %v", movie.ID.Hex(), err)
+			failed++
+			continue
+		}
+		migrated++
+	}
+	log.Printf("%d covers migrated, %d failed, dry run: %t", migrated, failed, *dryRun)
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// migrateCover copies the cover files of the movie to the storage, then points the movie at them
+func migrateCover(ctx context.Context, mr moviesrepo.Repo, store storage.Storage, dir string, movie *movies.Movie, dryRun bool) error {
+	cover := *movie.Cover
+	cover.Renditions = append([]movies.CoverRendition{}, movie.Cover.Renditions...)
+	files := map[string]string{cover.Key: cover.ContentType}
+	cover.Key = storage.CoversPrefix + cover.Key
+	for i := range cover.Renditions {
+		rendition := &cover.Renditions[i]
+		files[rendition.Key] = media.FormatTypes[rendition.Format]
+		rendition.Key = storage.CoversPrefix + rendition.Key
+	}
+
+	for key, contentType := range files {
+		// Keys are file names, anything else was not written by the app
+		if key == "" || strings.Contains(key, "/") {
+			return fmt.Errorf("unexpected cover key %q", key)
+		}
+		if err := copyFile(ctx, store, filepath.Join(dir, key), storage.CoversPrefix+key, contentType, dryRun); err != nil {
+			return err
+		}
+	}
+	if dryRun {
+		return nil
+	}
+	return mr.SetCover(movie, &cover)
+}
+
+// copyFile stores the file under the key, or only checks it exists in a dry run
+func copyFile(ctx context.Context, store storage.Storage, path string, key string, contentType string, dryRun bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil || dryRun {
+		return err
+	}
+	return store.Put(ctx, key, file, info.Size(), contentType)
+}
@@ -8,10 +8,14 @@ const (
 
 // Config object
 type Config struct {
-	Env     string        `env:"ENV"`
-	MongoDB MongoDBConfig `json:"mongodb"`
-	Host    string        `env:"APP_HOST"`
-	Port    string        `env:"APP_PORT"`
+	Env      string         `env:"ENV"`
+	MongoDB  MongoDBConfig  `json:"mongodb"`
+	Media    MediaConfig    `json:"media"`
+	Storage  StorageConfig  `json:"storage"`
+	Playback PlaybackConfig `json:"playback"`
+	Import   ImportConfig   `json:"import"`
+	Host     string         `env:"APP_HOST"`
+	Port     string         `env:"APP_PORT"`
 }
 
 // IsProd Checks if env is production
@@ -22,9 +26,13 @@ func (c Config) IsProd() bool {
 // GetConfig gets all config for the application
 func GetConfig() Config {
 	return Config{
-		Env:     os.Getenv("ENV"),
-		MongoDB: GetMongoDBConfig(),
-		Host:    os.Getenv("APP_HOST"),
-		Port:    os.Getenv("APP_PORT"),
+		Env:      os.Getenv("ENV"),
+		MongoDB:  GetMongoDBConfig(),
+		Media:    GetMediaConfig(),
+		Storage:  GetStorageConfig(),
+		Playback: GetPlaybackConfig(),
+		Import:   GetImportConfig(),
+		Host:     os.Getenv("APP_HOST"),
+		Port:     os.Getenv("APP_PORT"),
 	}
 }
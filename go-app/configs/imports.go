@@ -0,0 +1,14 @@
+package configs
+
+// ImportConfig object
+type ImportConfig struct {
+	// MaxBytes is the maximum size of the files imported over HTTP
+	MaxBytes int64 `env:"IMPORT_MAX_BYTES"` // i.e. 52428800 (50 MiB)
+}
+
+// GetImportConfig returns ImportConfig object, using defaults for unset variables
+func GetImportConfig() ImportConfig {
+	return ImportConfig{
+		MaxBytes: int64(getEnvInt("IMPORT_MAX_BYTES", 50<<20)),
+	}
+}
@@ -0,0 +1,73 @@
+package configs
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// MediaConfig object
+type MediaConfig struct {
+	CoverMaxBytes  int64 `env:"COVER_MAX_BYTES"`  // i.e. 5242880 (5 MiB)
+	CoverMinWidth  int   `env:"COVER_MIN_WIDTH"`  // i.e. 200
+	CoverMinHeight int   `env:"COVER_MIN_HEIGHT"` // i.e. 300
+	CoverMaxWidth  int   `env:"COVER_MAX_WIDTH"`  // i.e. 4000
+	CoverMaxHeight int   `env:"COVER_MAX_HEIGHT"` // i.e. 6000
+	// PresignExpiry is how long media download URLs handed out by the storage backend are valid
+	PresignExpiry time.Duration `env:"MEDIA_PRESIGN_EXPIRY"` // i.e. "15m"
+	// UploadsDir keeps the local files of video uploads in progress
+	UploadsDir    string `env:"MEDIA_UPLOADS_DIR"` // i.e. "/var/lib/go-app/uploads"
+	VideoMaxBytes int64  `env:"VIDEO_MAX_BYTES"`   // i.e. 10737418240 (10 GiB)
+	// UploadExpiry is how long a video upload receiving no bytes is kept before it expires
+	UploadExpiry time.Duration `env:"MEDIA_UPLOAD_EXPIRY"` // i.e. "24h"
+	// GCInterval is how often orphaned media files are swept, 0 disables the sweeper
+	GCInterval time.Duration `env:"MEDIA_GC_INTERVAL"` // i.e. "24h"
+	// GCGracePeriod is how old an orphaned media file must be before it is deleted
+	GCGracePeriod time.Duration `env:"MEDIA_GC_GRACE_PERIOD"` // i.e. "24h"
+	// URLSecret signs the media URLs handed out to users
+	URLSecret string `env:"MEDIA_URL_SECRET"`
+	// URLExpiry is how long signed media URLs are valid at least
+	URLExpiry time.Duration `env:"MEDIA_URL_EXPIRY"` // i.e. "4h"
+}
+
+// GetMediaConfig returns MediaConfig object, using defaults for unset variables
+func GetMediaConfig() MediaConfig {
+	return MediaConfig{
+		CoverMaxBytes:  int64(getEnvInt("COVER_MAX_BYTES", 5<<20)),
+		CoverMinWidth:  getEnvInt("COVER_MIN_WIDTH", 200),
+		CoverMinHeight: getEnvInt("COVER_MIN_HEIGHT", 300),
+		CoverMaxWidth:  getEnvInt("COVER_MAX_WIDTH", 4000),
+		CoverMaxHeight: getEnvInt("COVER_MAX_HEIGHT", 6000),
+		PresignExpiry:  getEnvDuration("MEDIA_PRESIGN_EXPIRY", 15*time.Minute),
+		UploadsDir:     getEnv("MEDIA_UPLOADS_DIR", "/var/lib/go-app/uploads"),
+		VideoMaxBytes:  int64(getEnvInt("VIDEO_MAX_BYTES", 10<<30)),
+		UploadExpiry:   getEnvDuration("MEDIA_UPLOAD_EXPIRY", 24*time.Hour),
+		GCInterval:     getEnvDuration("MEDIA_GC_INTERVAL", 24*time.Hour),
+		GCGracePeriod:  getEnvDuration("MEDIA_GC_GRACE_PERIOD", 24*time.Hour),
+		URLSecret:      os.Getenv("MEDIA_URL_SECRET"),
+		URLExpiry:      getEnvDuration("MEDIA_URL_EXPIRY", 4*time.Hour),
+	}
+}
+
+func getEnv(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getEnvInt(name string, fallback int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
+
+func getEnvDuration(name string, fallback time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return fallback
+	}
+	return value
+}
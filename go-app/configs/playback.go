@@ -0,0 +1,17 @@
+package configs
+
+// PlaybackConfig object
+type PlaybackConfig struct {
+	// WatchedThreshold is the percentage of a movie played to mark it as watched
+	WatchedThreshold float64 `env:"WATCHED_THRESHOLD_PERCENT"` // i.e. 90
+	// ContinueWatchingDays is how long a movie left unfinished stays in the "continue watching" row
+	ContinueWatchingDays int `env:"CONTINUE_WATCHING_DAYS"` // i.e. 30
+}
+
+// GetPlaybackConfig returns PlaybackConfig object, using defaults for unset variables
+func GetPlaybackConfig() PlaybackConfig {
+	return PlaybackConfig{
+		WatchedThreshold:     float64(getEnvInt("WATCHED_THRESHOLD_PERCENT", 90)),
+		ContinueWatchingDays: getEnvInt("CONTINUE_WATCHING_DAYS", 30),
+	}
+}
@@ -0,0 +1,35 @@
+package configs
+
+// Storage backends
+const (
+	StorageLocal = "local"
+	StorageS3    = "s3"
+)
+
+// StorageConfig object
+type StorageConfig struct {
+	Backend   string `env:"STORAGE_BACKEND"`   // "local" or "s3"
+	LocalDir  string `env:"STORAGE_LOCAL_DIR"` // i.e. "/var/lib/go-app/media"
+	Endpoint  string `env:"S3_ENDPOINT"`       // i.e. "minio:9000"
+	AccessKey string `env:"S3_ACCESS_KEY"`     // i.e. "minioadmin"
+	SecretKey string `env:"S3_SECRET_KEY"`     // i.e. "minioadmin"
+	Region    string `env:"S3_REGION"`         // i.e. "us-east-1"
+	UseSSL    bool   `env:"S3_USE_SSL"`        // i.e. false
+	Bucket    string `env:"S3_BUCKET"`         // i.e. "lw-netflix"
+	Prefix    string `env:"S3_PREFIX"`         // i.e. "media/"
+}
+
+// GetStorageConfig returns StorageConfig object, using defaults for unset variables
+func GetStorageConfig() StorageConfig {
+	return StorageConfig{
+		Backend:   getEnv("STORAGE_BACKEND", StorageLocal),
+		LocalDir:  getEnv("STORAGE_LOCAL_DIR", "/var/lib/go-app/media"),
+		Endpoint:  getEnv("S3_ENDPOINT", ""),
+		AccessKey: getEnv("S3_ACCESS_KEY", ""),
+		SecretKey: getEnv("S3_SECRET_KEY", ""),
+		Region:    getEnv("S3_REGION", ""),
+		UseSSL:    getEnv("S3_USE_SSL", "false") == "true",
+		Bucket:    getEnv("S3_BUCKET", ""),
+		Prefix:    getEnv("S3_PREFIX", ""),
+	}
+}
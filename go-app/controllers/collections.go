@@ -0,0 +1,380 @@
+package controllers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+	"github.com/kamva/mgm/v3"
+	"github.com/kamva/mgm/v3/operator"
+	"go-app/definitions/movies"
+	"go-app/definitions/users"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/http"
+)
+
+// CreateCollection creates a collection of movies for the current user, private unless told otherwise
+func (ctl *moviesController) CreateCollection(c *gin.Context) {
+	collectionInput, ok := ctl.bindCollectionInput(c)
+	if !ok {
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	movieIDs, ok := ctl.collectionMovies(c, currentUser, collectionInput.MovieIDs)
+	if !ok {
+		return
+	}
+	token, err := newShareToken()
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while creating collection", err.Error())
+		return
+	}
+	collection := &movies.MovieCollection{
+		OwnerID:     currentUser.ID,
+		Name:        collectionInput.Name,
+		Description: collectionInput.Description,
+		Visibility:  collectionInput.Visibility,
+		MovieIDs:    movieIDs,
+		ShareToken:  token,
+	}
+	if err = ctl.mr.SaveCollection(collection); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while creating collection", err.Error())
+		return
+	}
+	ctl.serveCollection(c, "Collection created", collection)
+}
+
+// UpdateCollection replaces the name, description, visibility and movies of a collection of the current user
+func (ctl *moviesController) UpdateCollection(c *gin.Context) {
+	collectionInput, ok := ctl.bindCollectionInput(c)
+	if !ok {
+		return
+	}
+	collection, ok := ctl.findOwnCollection(c)
+	if !ok {
+		return
+	}
+	movieIDs, ok := ctl.collectionMovies(c, c.MustGet("user").(*users.User), collectionInput.MovieIDs)
+	if !ok {
+		return
+	}
+	collection.Name = collectionInput.Name
+	collection.Description = collectionInput.Description
+	collection.Visibility = collectionInput.Visibility
+	collection.MovieIDs = movieIDs
+	if err := ctl.mr.SaveCollection(collection); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while updating collection", err.Error())
+		return
+	}
+	ctl.serveCollection(c, "Collection updated", collection)
+}
+
+// DeleteCollection deletes a collection of the current user
+func (ctl *moviesController) DeleteCollection(c *gin.Context) {
+	collection, ok := ctl.findOwnCollection(c)
+	if !ok {
+		return
+	}
+	if err := ctl.mr.DeleteCollection(collection); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while deleting collection", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "Collection deleted", nil)
+}
+
+// ListCollections lists the collections of the current user
+func (ctl *moviesController) ListCollections(c *gin.Context) {
+	currentUser := c.MustGet("user").(*users.User)
+	results, err := ctl.mr.ListCollections(currentUser.ID)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting collections", err.Error())
+		return
+	}
+	if err = ctl.countVisibleMovies(currentUser, results); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "List of collections", results)
+}
+
+// ListPublicCollections lists a page of the public collections, most recently updated first
+func (ctl *moviesController) ListPublicCollections(c *gin.Context) {
+	skip, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	results, err := ctl.mr.ListPublicCollections(skip, limit)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting collections", err.Error())
+		return
+	}
+	if err = ctl.countVisibleMovies(optionalUser(c), results); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "List of collections", results)
+}
+
+// RotateShareLink replaces the share link of a collection of the current user,
+// so the previous link stops working
+func (ctl *moviesController) RotateShareLink(c *gin.Context) {
+	collection, ok := ctl.findOwnCollection(c)
+	if !ok {
+		return
+	}
+	token, err := newShareToken()
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while rotating share link", err.Error())
+		return
+	}
+	collection.ShareToken = token
+	if err = ctl.mr.SaveCollection(collection); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while rotating share link", err.Error())
+		return
+	}
+	ctl.serveCollection(c, "Share link rotated", collection)
+}
+
+// GetCollection serves a public collection, or one of the current user
+func (ctl *moviesController) GetCollection(c *gin.Context) {
+	collection, ok := ctl.findCollection(c)
+	if !ok {
+		return
+	}
+	ctl.serveCollection(c, "Collection", collection)
+}
+
+// GetSharedCollection serves an unlisted or public collection from its share link
+func (ctl *moviesController) GetSharedCollection(c *gin.Context) {
+	collection, ok := ctl.findSharedCollection(c)
+	if !ok {
+		return
+	}
+	ctl.serveCollection(c, "Collection", collection)
+}
+
+// CopyCollection copies a public collection, or one of the current user, into a new private
+// collection of the current user
+func (ctl *moviesController) CopyCollection(c *gin.Context) {
+	source, ok := ctl.findCollection(c)
+	if !ok {
+		return
+	}
+	ctl.copyCollection(c, source)
+}
+
+// CopySharedCollection copies an unlisted or public collection from its share link
+// into a new private collection of the current user
+func (ctl *moviesController) CopySharedCollection(c *gin.Context) {
+	source, ok := ctl.findSharedCollection(c)
+	if !ok {
+		return
+	}
+	ctl.copyCollection(c, source)
+}
+
+func (ctl *moviesController) copyCollection(c *gin.Context, source *movies.MovieCollection) {
+	currentUser := c.MustGet("user").(*users.User)
+	// Movies the current user can't see are left out of the copy
+	visible, err := ctl.visibleMovies(currentUser, source.MovieIDs)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	movieIDs := []primitive.ObjectID{}
+	for _, id := range source.MovieIDs {
+		if visible[id] {
+			movieIDs = append(movieIDs, id)
+		}
+	}
+	token, err := newShareToken()
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while copying collection", err.Error())
+		return
+	}
+	copiedFrom := source.ID
+	collection := &movies.MovieCollection{
+		OwnerID:     currentUser.ID,
+		Name:        source.Name,
+		Description: source.Description,
+		Visibility:  movies.VisibilityPrivate,
+		MovieIDs:    movieIDs,
+		ShareToken:  token,
+		CopiedFrom:  &copiedFrom,
+	}
+	if err = ctl.mr.SaveCollection(collection); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while copying collection", err.Error())
+		return
+	}
+	ctl.serveCollection(c, "Collection copied", collection)
+}
+
+// bindCollectionInput reads the collection of the request body
+func (ctl *moviesController) bindCollectionInput(c *gin.Context) (*movies.CollectionInput, bool) {
+	var collectionInput movies.CollectionInput
+	if err := c.ShouldBindJSON(&collectionInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return nil, false
+	}
+	if err := conform.Struct(context.Background(), &collectionInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return nil, false
+	}
+	if collectionInput.Visibility == "" {
+		collectionInput.Visibility = movies.VisibilityPrivate
+	}
+	return &collectionInput, true
+}
+
+// collectionMovies parses the movies of a collection, checking the user can see each of them
+func (ctl *moviesController) collectionMovies(c *gin.Context, user *users.User, hexIDs []string) ([]primitive.ObjectID, bool) {
+	movieIDs := make([]primitive.ObjectID, 0, len(hexIDs))
+	seen := map[primitive.ObjectID]bool{}
+	for _, hexID := range hexIDs {
+		id, err := primitive.ObjectIDFromHex(hexID)
+		if err != nil {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid movie ID "+hexID)
+			return nil, false
+		}
+		if seen[id] {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie "+hexID+" is listed twice")
+			return nil, false
+		}
+		seen[id] = true
+		movieIDs = append(movieIDs, id)
+	}
+	visible, err := ctl.visibleMovies(user, movieIDs)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return nil, false
+	}
+	for _, id := range movieIDs {
+		if !visible[id] {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie "+id.Hex()+" not found")
+			return nil, false
+		}
+	}
+	return movieIDs, true
+}
+
+// visibleMovies returns which of the movies exist and can be seen by the user
+func (ctl *moviesController) visibleMovies(user *users.User, ids []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	visible := map[primitive.ObjectID]bool{}
+	if len(ids) == 0 {
+		return visible, nil
+	}
+	found := []movies.Movie{}
+	err := mgm.Coll(&movies.Movie{}).SimpleFind(&found, bson.M{"_id": bson.M{operator.In: ids}})
+	if err != nil {
+		return nil, err
+	}
+	for i := range found {
+		visible[found[i].ID] = found[i].CanView(user)
+	}
+	return visible, nil
+}
+
+// countVisibleMovies sets the number of movies of each collection the user can see
+func (ctl *moviesController) countVisibleMovies(user *users.User, collections []movies.CollectionSummary) error {
+	ids := []primitive.ObjectID{}
+	for _, collection := range collections {
+		ids = append(ids, collection.MovieIDs...)
+	}
+	visible, err := ctl.visibleMovies(user, ids)
+	if err != nil {
+		return err
+	}
+	for i := range collections {
+		collections[i].MoviesCount = 0
+		for _, id := range collections[i].MovieIDs {
+			if visible[id] {
+				collections[i].MoviesCount++
+			}
+		}
+	}
+	return nil
+}
+
+// findCollection loads the collection of the request, if the current user may see it
+func (ctl *moviesController) findCollection(c *gin.Context) (*movies.MovieCollection, bool) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HTTPRes(c, http.StatusNotFound, "Collection not found", nil)
+		return nil, false
+	}
+	collection, err := ctl.mr.FindCollection(id)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting collection", err.Error())
+		return nil, false
+	}
+	if collection == nil || !collection.CanView(optionalUser(c)) {
+		HTTPRes(c, http.StatusNotFound, "Collection not found", nil)
+		return nil, false
+	}
+	return collection, true
+}
+
+// findOwnCollection loads the collection of the request, if it belongs to the current user
+func (ctl *moviesController) findOwnCollection(c *gin.Context) (*movies.MovieCollection, bool) {
+	collection, ok := ctl.findCollection(c)
+	if !ok {
+		return nil, false
+	}
+	if collection.OwnerID != c.MustGet("user").(*users.User).ID {
+		HTTPRes(c, http.StatusForbidden, "Insufficient permissions", "Only the owner of a collection can change it")
+		return nil, false
+	}
+	return collection, true
+}
+
+// findSharedCollection loads the collection shared with the link of the request,
+// which stops working once the collection is made private
+func (ctl *moviesController) findSharedCollection(c *gin.Context) (*movies.MovieCollection, bool) {
+	collection, err := ctl.mr.FindSharedCollection(c.Param("token"))
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting collection", err.Error())
+		return nil, false
+	}
+	if collection == nil || collection.Visibility == movies.VisibilityPrivate {
+		HTTPRes(c, http.StatusNotFound, "Collection not found", nil)
+		return nil, false
+	}
+	return collection, true
+}
+
+// serveCollection responds with the collection and the movies the current user can see in it.
+// Only the owner gets the share link.
+func (ctl *moviesController) serveCollection(c *gin.Context, msg string, collection *movies.MovieCollection) {
+	currentUser := optionalUser(c)
+	results, err := ctl.listMoviesByID(c, currentUser, collection.MovieIDs)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	output := &movies.CollectionOutput{
+		ID:          collection.ID,
+		OwnerID:     collection.OwnerID,
+		Name:        collection.Name,
+		Description: collection.Description,
+		Visibility:  collection.Visibility,
+		CopiedFrom:  collection.CopiedFrom,
+		Movies:      results,
+		CreatedAt:   collection.CreatedAt,
+		UpdatedAt:   collection.UpdatedAt,
+	}
+	if currentUser != nil && currentUser.ID == collection.OwnerID {
+		output.ShareURL = collection.ShareURL()
+	}
+	c.Header("Vary", "Accept-Language")
+	HTTPRes(c, http.StatusOK, msg, output)
+}
+
+// newShareToken returns the secret part of a collection share link
+func newShareToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(token), nil
+}
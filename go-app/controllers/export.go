@@ -0,0 +1,113 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"go-app/definitions/movies"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportFlushEvery is how many rows are written between flushes of the response
+const exportFlushEvery = 100
+
+var exportCSVHeader = []string{
+	"id", "external_id", "name", "description", "date", "rating", "reviews_count", "created_at", "updated_at",
+}
+
+// exportWriter writes catalog export rows to the response as they are read
+type exportWriter struct {
+	format string
+	w      gin.ResponseWriter
+	csv    *csv.Writer
+	rows   int
+}
+
+func newExportWriter(format string, w gin.ResponseWriter) *exportWriter {
+	ew := &exportWriter{format: format, w: w}
+	if format == "csv" {
+		ew.csv = csv.NewWriter(w)
+	}
+	return ew
+}
+
+func (ew *exportWriter) contentType() string {
+	switch ew.format {
+	case "csv":
+		return "text/csv; charset=utf-8"
+	case "ndjson":
+		return "application/x-ndjson"
+	}
+	return "application/json; charset=utf-8"
+}
+
+func (ew *exportWriter) begin() error {
+	switch ew.format {
+	case "csv":
+		return ew.csv.Write(exportCSVHeader)
+	case "json":
+		_, err := ew.w.WriteString("[")
+		return err
+	}
+	return nil
+}
+
+func (ew *exportWriter) write(row *movies.MovieExport) error {
+	ew.rows++
+	if ew.format == "csv" {
+		return ew.csv.Write([]string{
+			row.ID.Hex(),
+			row.ExternalID,
+			row.Name,
+			row.Description,
+			row.Date.String(),
+			strconv.FormatFloat(float64(row.Rating), 'f', 1, 32),
+			strconv.Itoa(row.ReviewsCount),
+			formatExportTime(row.CreatedAt),
+			formatExportTime(row.UpdatedAt),
+		})
+	}
+
+	encoded, err := json.Marshal(row)
+	if err != nil {
+		return err
+	}
+	if ew.format == "json" {
+		if ew.rows > 1 {
+			encoded = append([]byte(","), encoded...)
+		}
+	} else {
+		encoded = append(encoded, '\n')
+	}
+	_, err = ew.w.Write(encoded)
+	return err
+}
+
+func (ew *exportWriter) flush() {
+	if ew.csv != nil {
+		ew.csv.Flush()
+	}
+	ew.w.Flush()
+}
+
+func (ew *exportWriter) end() error {
+	if ew.format == "json" {
+		if _, err := ew.w.WriteString("]"); err != nil {
+			return err
+		}
+	}
+	ew.flush()
+	if ew.csv != nil {
+		return ew.csv.Error()
+	}
+	return nil
+}
+
+func formatExportTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
@@ -3,6 +3,9 @@ package controllers
 import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/mold/v4/modifiers"
+	"go-app/definitions/users"
+	"net/http"
+	"strconv"
 )
 
 // Response object as HTTP response
@@ -23,3 +26,33 @@ func HTTPRes(c *gin.Context, httpCode int, msg string, data interface{}) {
 }
 
 var conform = modifiers.New()
+
+// optionalUser returns the current user, or nil for anonymous requests
+func optionalUser(c *gin.Context) *users.User {
+	if value, ok := c.Get("user"); ok {
+		return value.(*users.User)
+	}
+	return nil
+}
+
+// Pagination limits of listings supporting page and page_size
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// parsePagination parses the page and page_size query parameters, returning how many results to skip
+// and the page size, or responding with 400 when they are invalid
+func parsePagination(c *gin.Context) (skip int64, limit int64, ok bool) {
+	page, err := strconv.ParseInt(c.DefaultQuery("page", "1"), 10, 64)
+	if err != nil || page < 1 {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "page must be a positive number")
+		return 0, 0, false
+	}
+	limit, err = strconv.ParseInt(c.DefaultQuery("page_size", strconv.Itoa(defaultPageSize)), 10, 64)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "page_size must be between 1 and "+strconv.Itoa(maxPageSize))
+		return 0, 0, false
+	}
+	return (page - 1) * limit, limit, true
+}
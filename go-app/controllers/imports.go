@@ -0,0 +1,152 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/kamva/mgm/v3"
+	"go-app/configs"
+	"go-app/definitions/movies"
+	"go-app/definitions/users"
+	"go-app/importer"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ImportsController interface
+type ImportsController interface {
+	StartImport(*gin.Context)
+	GetImportJob(*gin.Context)
+}
+
+type importsController struct {
+	im     *importer.Importer
+	config configs.ImportConfig
+}
+
+// NewImportsController instantiates Imports Controller
+func NewImportsController(im *importer.Importer, config configs.ImportConfig) ImportsController {
+	return &importsController{im: im, config: config}
+}
+
+// errBodyTooLarge is the message of the error http.MaxBytesReader returns past its limit
+const errBodyTooLarge = "http: request body too large"
+
+// contentTypeFormats maps request content types to import formats
+var contentTypeFormats = map[string]string{
+	"text/csv":             importer.FormatCSV,
+	"application/json":     importer.FormatJSON,
+	"application/x-ndjson": importer.FormatNDJSON,
+	"application/ndjson":   importer.FormatNDJSON,
+}
+
+// StartImport stores the uploaded file and imports it in the background.
+// The file is either the request body or the "file" field of a multipart form.
+func (ctl *importsController) StartImport(c *gin.Context) {
+	format := strings.ToLower(c.Query("format"))
+	if format == "" {
+		format = contentTypeFormats[c.ContentType()]
+	}
+	if !importer.ValidFormat(format) {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Import format must be csv, json or ndjson")
+		return
+	}
+
+	dryRun := false
+	if value := c.Query("dry_run"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid dry_run value")
+			return
+		}
+	}
+
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, ctl.config.MaxBytes)
+	var body io.Reader = c.Request.Body
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		fileHeader, err := c.FormFile("file")
+		if err != nil {
+			if strings.Contains(err.Error(), errBodyTooLarge) {
+				HTTPRes(c, http.StatusRequestEntityTooLarge, "File upload error", "Import file is too large")
+				return
+			}
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+			return
+		}
+		file, err := fileHeader.Open()
+		if err != nil {
+			HTTPRes(c, http.StatusBadRequest, "File upload error", err.Error())
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	tmpFile, err := ioutil.TempFile("", "movies-import-*")
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while storing import file", err.Error())
+		return
+	}
+	if _, err = io.Copy(tmpFile, body); err == nil {
+		_, err = tmpFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		if err.Error() == errBodyTooLarge {
+			HTTPRes(c, http.StatusRequestEntityTooLarge, "File upload error", "Import file is too large")
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while storing import file", err.Error())
+		return
+	}
+
+	currentUser := c.MustGet("user").(*users.User)
+	job, err := ctl.im.CreateJob(format, dryRun, currentUser)
+	if err != nil {
+		tmpFile.Close()
+		os.Remove(tmpFile.Name())
+		HTTPRes(c, http.StatusInternalServerError, "Failed while creating import job", err.Error())
+		return
+	}
+
+	go func() {
+		defer os.Remove(tmpFile.Name())
+		defer tmpFile.Close()
+		if err := ctl.im.Run(job, tmpFile, currentUser); err != nil {
+			log.Printf("import job %s failed: %v", job.ID.Hex(), err)
+		}
+	}()
+
+	HTTPRes(c, http.StatusAccepted, "Import started", job)
+}
+
+func (ctl *importsController) GetImportJob(c *gin.Context) {
+	jobId := c.Param("job")
+	if jobId == "" {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Import job ID not provided")
+		return
+	}
+
+	currentUser := c.MustGet("user").(*users.User)
+	job := &movies.ImportJob{}
+	err := mgm.Coll(job).FindByID(jobId, job)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Import job not found", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting import job", err.Error())
+		return
+	}
+	if job.StartedBy != currentUser.ID {
+		HTTPRes(c, http.StatusForbidden, "Error getting import job", "Import job was not started by current user")
+		return
+	}
+
+	HTTPRes(c, http.StatusOK, "Import job", job)
+}
@@ -0,0 +1,56 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-app/definitions/movies"
+	"golang.org/x/text/language"
+)
+
+// preferredLanguages returns the languages the client asked for, in order of preference:
+// the lang query parameter, the current user's preference, then the Accept-Language header
+func preferredLanguages(c *gin.Context) []language.Tag {
+	var preferred []language.Tag
+	if tag, err := language.Parse(c.Query("lang")); err == nil {
+		preferred = append(preferred, tag)
+	}
+	if user := optionalUser(c); user != nil {
+		if tag, err := language.Parse(user.Language); err == nil {
+			preferred = append(preferred, tag)
+		}
+	}
+	if tags, _, err := language.ParseAcceptLanguage(c.GetHeader("Accept-Language")); err == nil {
+		preferred = append(preferred, tags...)
+	}
+	return preferred
+}
+
+// localizeMovie replaces the name and description of the movie with the translation
+// that best matches the preferred languages, keeping the original when none does.
+// The original language, when known, is matched too, so it wins over a translation
+// into a language the client prefers less.
+func localizeMovie(movie *movies.MovieInfo, preferred []language.Tag) {
+	if len(preferred) == 0 || len(movie.Translations) == 0 {
+		return
+	}
+
+	tags := make([]language.Tag, 0, len(movie.Translations)+1)
+	offset := 0
+	if movie.OriginalLanguage != "" {
+		tags = append(tags, language.Make(movie.OriginalLanguage))
+		offset = 1
+	}
+	for _, translation := range movie.Translations {
+		tags = append(tags, language.Make(translation.Lang))
+	}
+	_, index, confidence := language.NewMatcher(tags).Match(preferred...)
+	if confidence == language.No || index < offset {
+		return
+	}
+
+	translation := movie.Translations[index-offset]
+	movie.Name = translation.Name
+	if translation.Description != "" {
+		movie.Description = translation.Description
+	}
+	movie.Language = translation.Lang
+}
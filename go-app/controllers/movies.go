@@ -1,43 +1,101 @@
 package controllers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	jsonpatch "github.com/evanphx/json-patch"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/kamva/mgm/v3"
 	"github.com/kamva/mgm/v3/builder"
 	"github.com/kamva/mgm/v3/operator"
+	"go-app/configs"
 	"go-app/definitions/movies"
 	"go-app/definitions/users"
+	"go-app/media"
+	"go-app/mediaurls"
 	"go-app/repositories/moviesrepo"
 	"go-app/repositories/usersrepo"
+	"go-app/storage"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/text/language"
+	"io/ioutil"
+	"log"
 	"net/http"
+	"path"
+	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 // MoviesController interface
 type MoviesController interface {
 	AddMovie(*gin.Context)
 	UploadCover(*gin.Context)
+	ServeCover(c *gin.Context)
 	UpdateMovie(*gin.Context)
 	DeleteMovie(c *gin.Context)
 	WatchMovie(c *gin.Context)
+	ReportProgress(c *gin.Context)
+	ListContinueWatching(c *gin.Context)
+	DismissContinueWatching(c *gin.Context)
+	ListWatchlist(c *gin.Context)
+	AddToWatchlist(c *gin.Context)
+	RemoveFromWatchlist(c *gin.Context)
+	ReorderWatchlist(c *gin.Context)
+	CreateCollection(c *gin.Context)
+	UpdateCollection(c *gin.Context)
+	DeleteCollection(c *gin.Context)
+	ListCollections(c *gin.Context)
+	ListPublicCollections(c *gin.Context)
+	GetCollection(c *gin.Context)
+	GetSharedCollection(c *gin.Context)
+	CopyCollection(c *gin.Context)
+	RotateShareLink(c *gin.Context)
+	CopySharedCollection(c *gin.Context)
+	StreamMovie(c *gin.Context)
+	UploadSubtitles(c *gin.Context)
+	DeleteSubtitles(c *gin.Context)
+	ServeSubtitles(c *gin.Context)
 	ReviewMovie(c *gin.Context)
 	ListWatchedMovies(c *gin.Context)
 	ListMovies(c *gin.Context)
+	ExportMovies(c *gin.Context)
 	GetMovieInfo(c *gin.Context)
+	PatchMovie(c *gin.Context)
+	SetTranslation(c *gin.Context)
+	DeleteTranslation(c *gin.Context)
+	MergeMovies(c *gin.Context)
+	ListCollaborators(c *gin.Context)
+	AddCollaborator(c *gin.Context)
+	RemoveCollaborator(c *gin.Context)
+	TransferOwnership(c *gin.Context)
+	SubmitMovie(c *gin.Context)
+	ListModerationQueue(c *gin.Context)
+	ApproveMovie(c *gin.Context)
+	RejectMovie(c *gin.Context)
+	GetMovieHistory(c *gin.Context)
+	RevertMovie(c *gin.Context)
 }
 
 type moviesController struct {
-	mr moviesrepo.Repo
-	ur usersrepo.Repo
+	mr       moviesrepo.Repo
+	ur       usersrepo.Repo
+	media    configs.MediaConfig
+	store    storage.Storage
+	signer   *mediaurls.Signer
+	playback configs.PlaybackConfig
 }
 
 // NewMoviesController instantiates User Controller
-func NewMoviesController(br moviesrepo.Repo, us usersrepo.Repo) MoviesController {
-	return &moviesController{mr: br, ur: us}
+func NewMoviesController(br moviesrepo.Repo, us usersrepo.Repo, media configs.MediaConfig, store storage.Storage, signer *mediaurls.Signer, playback configs.PlaybackConfig) MoviesController {
+	return &moviesController{mr: br, ur: us, media: media, store: store, signer: signer, playback: playback}
 }
 
 func (ctl *moviesController) AddMovie(c *gin.Context) {
@@ -49,13 +107,26 @@ func (ctl *moviesController) AddMovie(c *gin.Context) {
 	movie, err := ctl.inputToMovie(movieInput, c)
 	if err != nil {
 		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	if force, _ := strconv.ParseBool(c.Query("force")); !force {
+		candidates, err := ctl.mr.FindDuplicates(movie, c.MustGet("user").(*users.User))
+		if err != nil {
+			HTTPRes(c, http.StatusInternalServerError, "Failed while checking for duplicate movies", err.Error())
+			return
+		}
+		if len(candidates) > 0 {
+			HTTPRes(c, http.StatusConflict, "Possible duplicate movies, use force=true to add it anyway", candidates)
+			return
+		}
 	}
 	if err := mgm.Coll(movie).Create(movie); err != nil {
 		HTTPRes(c, http.StatusInternalServerError, "Failed while adding movie", err.Error())
 		return
 	}
 
-	output := ctl.movieToOutput(movie)
+	output := ctl.movieToOutput(c, movie)
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
 	HTTPRes(c, http.StatusOK, "Movie added", output)
 }
 
@@ -63,22 +134,75 @@ func (ctl *moviesController) inputToMovie(input movies.AddMovieInput, c *gin.Con
 	if err := conform.Struct(context.Background(), &input); err != nil {
 		return nil, err
 	}
+	originalLanguage, err := movies.ParseLanguage(input.OriginalLanguage)
+	if err != nil {
+		return nil, err
+	}
 
 	currentUser := c.MustGet("user").(*users.User)
 	return &movies.Movie{
-		Name:        input.Name,
-		Description: input.Description,
-		Date:        input.Date,
-		AddedBy:     currentUser.ID,
+		Name:             input.Name,
+		Description:      input.Description,
+		Date:             input.Date,
+		OriginalLanguage: originalLanguage,
+		AddedBy:          currentUser.ID,
+		Status:           movies.StatusDraft,
 	}, nil
 }
-func (ctl *moviesController) movieToOutput(movie *movies.Movie) *movies.AddMovieOutput {
+func (ctl *moviesController) movieToOutput(c *gin.Context, movie *movies.Movie) *movies.AddMovieOutput {
+	status := movie.Status
+	if movie.IsPublished() {
+		status = movies.StatusPublished
+	}
 	return &movies.AddMovieOutput{
-		ID:          movie.ID.Hex(),
-		Name:        movie.Name,
-		Description: movie.Description,
-		Date:        movie.Date,
+		ID:               movie.ID.Hex(),
+		Name:             movie.Name,
+		Description:      movie.Description,
+		Date:             movie.Date,
+		OriginalLanguage: movie.OriginalLanguage,
+		Status:           status,
+		RejectionReason:  movie.RejectionReason,
+		CoverURLs:        ctl.coverURLs(c, movie.ID, movie.Cover, movie.IsPublished()),
+	}
+}
+
+// Actions on a movie checked by authorizeMovie
+const (
+	// movieActionEdit changes the movie, allowed to its owner and editors
+	movieActionEdit = "edit"
+	// movieActionManage deletes the movie or changes who can edit it, allowed to its owner only
+	movieActionManage = "manage"
+)
+
+// authorizeMovie checks if the user may perform the action on the movie, responding with 403 if not
+func (ctl *moviesController) authorizeMovie(c *gin.Context, movie *movies.Movie, user *users.User, action string) bool {
+	allowed := movie.CanEdit(user)
+	if action == movieActionManage {
+		allowed = movie.CanManage(user)
+	}
+	if !allowed {
+		HTTPRes(c, http.StatusForbidden, "Insufficient permissions", "Current user is not allowed to "+action+" this movie")
+		return false
+	}
+	return true
+}
+
+// checkIfMatch requires an If-Match header matching the current movie version
+func (ctl *moviesController) checkIfMatch(c *gin.Context, movie *movies.Movie) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		HTTPRes(c, http.StatusPreconditionRequired, "Precondition Required", "If-Match header not provided")
+		return false
+	}
+	current := movies.ETag(movie.UpdatedAt)
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" || tag == current {
+			return true
+		}
 	}
+	HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", "Movie was modified since it was retrieved")
+	return false
 }
 
 func (ctl *moviesController) UploadCover(c *gin.Context) {
@@ -92,72 +216,882 @@ func (ctl *moviesController) UploadCover(c *gin.Context) {
 		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie ID not provided")
 		return
 	}
+	currentUser := c.MustGet("user").(*users.User)
+	movie := &movies.Movie{}
+	err := mgm.Coll(movie).FindByID(movieId, movie)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	if !ctl.authorizeMovie(c, movie, currentUser, movieActionEdit) {
+		return
+	}
+	if !ctl.checkIfMatch(c, movie) {
+		return
+	}
+
+	if uploadCoverInput.Cover.Size > ctl.media.CoverMaxBytes {
+		HTTPRes(c, http.StatusRequestEntityTooLarge, "File upload error", media.ErrCoverTooLarge.Error())
+		return
+	}
+	file, err := uploadCoverInput.Cover.Open()
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "File upload error", err.Error())
+		return
+	}
+	defer file.Close()
+	cover, err := media.ProcessCover(file, media.CoverLimits{
+		MaxBytes:  ctl.media.CoverMaxBytes,
+		MinWidth:  ctl.media.CoverMinWidth,
+		MinHeight: ctl.media.CoverMinHeight,
+		MaxWidth:  ctl.media.CoverMaxWidth,
+		MaxHeight: ctl.media.CoverMaxHeight,
+	})
+	if err != nil {
+		switch err {
+		case media.ErrCoverTooLarge:
+			HTTPRes(c, http.StatusRequestEntityTooLarge, "File upload error", err.Error())
+		case media.ErrUnsupportedCover:
+			HTTPRes(c, http.StatusUnsupportedMediaType, "File upload error", err.Error())
+		default:
+			HTTPRes(c, http.StatusBadRequest, "File upload error", err.Error())
+		}
+		return
+	}
+
+	renditions, err := media.RenderCover(cover)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while resizing cover", err.Error())
+		return
+	}
+	placeholder, err := media.CoverPlaceholder(cover)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while computing cover placeholder", err.Error())
+		return
+	}
+
+	// Cover files are named after the cover version, so the files of the current cover
+	// are left untouched until the movie version check passed
+	version := cover.Version()
+	prefix := storage.CoversPrefix + movie.ID.Hex() + "-" + version
+	info := &movies.CoverInfo{
+		Key:         prefix + media.Extensions[cover.ContentType],
+		ContentType: cover.ContentType,
+		Width:       cover.Width,
+		Height:      cover.Height,
+		Size:        int64(len(cover.Data)),
+		Version:     version,
+		CoverPlaceholder: movies.CoverPlaceholder{
+			BlurHash:      placeholder.BlurHash,
+			DominantColor: placeholder.DominantColor,
+			AspectRatio:   placeholder.AspectRatio,
+		},
+	}
+	files := map[string]coverFile{info.Key: {data: cover.Data, contentType: cover.ContentType}}
+	for _, rendition := range renditions {
+		key := info.Key
+		contentType := media.FormatTypes[rendition.Format]
+		if rendition.Size != media.SizeOriginal || contentType != cover.ContentType {
+			key = prefix + "-" + rendition.Size + media.Extensions[contentType]
+			files[key] = coverFile{data: rendition.Data, contentType: contentType}
+		}
+		info.Renditions = append(info.Renditions, movies.CoverRendition{
+			Size:   rendition.Size,
+			Format: rendition.Format,
+			Key:    key,
+			Width:  rendition.Width,
+			Height: rendition.Height,
+			Bytes:  int64(len(rendition.Data)),
+		})
+	}
+	ctx := c.Request.Context()
+	for key, file := range files {
+		if err := ctl.store.Put(ctx, key, bytes.NewReader(file.data), int64(len(file.data)), file.contentType); err != nil {
+			HTTPRes(c, http.StatusInternalServerError, "Failed while storing cover", err.Error())
+			return
+		}
+	}
+
+	previous := movie.Cover
+	sameCover := previous != nil && previous.Version == version
+	err = ctl.mr.SetCover(movie, info)
+	if err != nil {
+		if !sameCover {
+			ctl.removeCoverFiles(ctx, info)
+		}
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while updating movie", err.Error())
+		return
+	}
+	if previous != nil && !sameCover {
+		ctl.removeCoverFiles(ctx, previous)
+	}
+
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
+	HTTPRes(c, http.StatusOK, "Cover uploaded", movie.Cover)
+}
+
+// coverFile is a cover file to store
+type coverFile struct {
+	data        []byte
+	contentType string
+}
+
+// removeCoverFiles removes the uploaded cover and its renditions from the storage
+func (ctl *moviesController) removeCoverFiles(ctx context.Context, cover *movies.CoverInfo) {
+	_ = ctl.store.Delete(ctx, cover.Key)
+	for _, rendition := range cover.Renditions {
+		_ = ctl.store.Delete(ctx, rendition.Key)
+	}
+}
+
+// coverMaxAge is how long versioned cover URLs may be cached, they never change content
+const coverMaxAge = 365 * 24 * 60 * 60
+
+// coverURLs returns the cover URLs of a movie. Covers of published movies are public, those of
+// other movies are signed for the current user, so they can be loaded without a token.
+func (ctl *moviesController) coverURLs(c *gin.Context, movieID primitive.ObjectID, cover *movies.CoverInfo, published bool) *movies.CoverURLs {
+	urls := movies.NewCoverURLs(movieID, cover)
+	currentUser := optionalUser(c)
+	if urls == nil || published || currentUser == nil {
+		return urls
+	}
+	urls.Thumb = ctl.signer.Sign(urls.Thumb, currentUser)
+	urls.Medium = ctl.signer.Sign(urls.Medium, currentUser)
+	urls.Original = ctl.signer.Sign(urls.Original, currentUser)
+	return urls
+}
+
+// ServeCover serves a cover rendition. URLs carrying the current cover version are cached
+// for good, others are revalidated against the ETag of the rendition.
+func (ctl *moviesController) ServeCover(c *gin.Context) {
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	if movie.Cover == nil || !movie.CanView(optionalUser(c)) {
+		HTTPRes(c, http.StatusNotFound, "Cover not found", nil)
+		return
+	}
+
+	size := c.DefaultQuery("size", media.SizeMedium)
+	validSize := false
+	for _, s := range media.Sizes {
+		validSize = validSize || s == size
+	}
+	if !validSize {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Size must be one of "+strings.Join(media.Sizes, ", "))
+		return
+	}
+	format := c.Query("format")
+	if format == "" {
+		// Without an explicit format, WebP is served to clients accepting it
+		format = media.FormatJPEG
+		if strings.Contains(c.GetHeader("Accept"), media.WebP) {
+			format = media.FormatWebP
+		}
+		c.Header("Vary", "Accept")
+	}
+	if _, ok := media.FormatTypes[format]; !ok {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Format must be one of "+strings.Join(media.Formats, ", "))
+		return
+	}
+
+	rendition := movie.Cover.Rendition(size, format)
+	if rendition == nil && len(movie.Cover.Renditions) == 0 &&
+		size == media.SizeOriginal && media.FormatTypes[format] == movie.Cover.ContentType {
+		// Covers uploaded before renditions existed only have their original
+		rendition = &movies.CoverRendition{Key: movie.Cover.Key}
+	}
+	if rendition == nil {
+		HTTPRes(c, http.StatusNotFound, "Cover rendition not available", nil)
+		return
+	}
+
+	// Backends able to hand out download URLs serve the cover themselves
+	url, err := ctl.store.PresignedURL(c.Request.Context(), rendition.Key, ctl.media.PresignExpiry)
+	if err == nil {
+		c.Header("Cache-Control", "private, max-age="+strconv.Itoa(int(ctl.media.PresignExpiry.Seconds()/2)))
+		c.Redirect(http.StatusTemporaryRedirect, url)
+		return
+	}
+	if err != storage.ErrPresignNotSupported {
+		HTTPRes(c, http.StatusInternalServerError, "Error reading cover", err.Error())
+		return
+	}
+	blob, err := ctl.store.Open(c.Request.Context(), rendition.Key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			HTTPRes(c, http.StatusNotFound, "Cover not found", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error reading cover", err.Error())
+		return
+	}
+	defer blob.Close()
+
+	version := movie.Cover.Version
+	if version == "" {
+		version = strings.Trim(movies.ETag(movie.UpdatedAt), `"`)
+	}
+	switch {
+	case !movie.IsPublished():
+		c.Header("Cache-Control", "private, no-cache")
+	case movie.Cover.Version != "" && c.Query("v") == movie.Cover.Version:
+		c.Header("Cache-Control", "public, max-age="+strconv.Itoa(coverMaxAge)+", immutable")
+	default:
+		c.Header("Cache-Control", "public, no-cache")
+	}
+	c.Header("ETag", `"`+version+"-"+size+"-"+format+`"`)
+	c.Header("Content-Type", media.FormatTypes[format])
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, blob)
+}
+
+func (ctl *moviesController) UpdateMovie(c *gin.Context) {
+	var movieInput movies.UpdateMovieInput
+	if err := c.ShouldBindJSON(&movieInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+
+	movieId := c.Param("id")
+	if movieId == "" {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie ID not provided")
+		return
+	}
+
+	currentUser := c.MustGet("user").(*users.User)
+	movie := &movies.Movie{}
+	err := mgm.Coll(movie).FindByID(movieId, movie)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	if !ctl.authorizeMovie(c, movie, currentUser, movieActionEdit) {
+		return
+	}
+	if !ctl.checkIfMatch(c, movie) {
+		return
+	}
+	before := *movie
+	err = ctl.updateMovieInputToMovie(movieInput, movie)
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+
+	err = ctl.mr.UpdateMovieWithRevision(&before, movie, currentUser)
+	if err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while updating movie", err.Error())
+		return
+	}
+
+	_ = mgm.Coll(movie).FindByID(movieId, movie)
+	output := ctl.movieToOutput(c, movie)
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
+	HTTPRes(c, http.StatusOK, "Movie Updated", output)
+}
+
+// SetTranslation adds or replaces the localized name and description of a movie for a language
+func (ctl *moviesController) SetTranslation(c *gin.Context) {
+	var translationInput movies.TranslationInput
+	if err := c.ShouldBindJSON(&translationInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	if err := conform.Struct(context.Background(), &translationInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	lang, err := language.Parse(c.Param("lang"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid language tag")
+		return
+	}
+
+	translation := movies.MovieTranslation{
+		Lang:        lang.String(),
+		Name:        translationInput.Name,
+		Description: translationInput.Description,
+	}
+	ctl.updateTranslations(c, "Translation saved", func(translations []movies.MovieTranslation) []movies.MovieTranslation {
+		for i := range translations {
+			if translations[i].Lang == translation.Lang {
+				translations[i] = translation
+				return translations
+			}
+		}
+		return append(translations, translation)
+	})
+}
+
+func (ctl *moviesController) DeleteTranslation(c *gin.Context) {
+	lang, err := language.Parse(c.Param("lang"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid language tag")
+		return
+	}
+
+	ctl.updateTranslations(c, "Translation deleted", func(translations []movies.MovieTranslation) []movies.MovieTranslation {
+		kept := []movies.MovieTranslation{}
+		for _, translation := range translations {
+			if translation.Lang != lang.String() {
+				kept = append(kept, translation)
+			}
+		}
+		return kept
+	})
+}
+
+// updateTranslations applies change to the translations of the movie and saves it as a new revision
+func (ctl *moviesController) updateTranslations(c *gin.Context, msg string, change func([]movies.MovieTranslation) []movies.MovieTranslation) {
+	movieId := c.Param("id")
+	if movieId == "" {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie ID not provided")
+		return
+	}
+
+	currentUser := c.MustGet("user").(*users.User)
+	movie := &movies.Movie{}
+	err := mgm.Coll(movie).FindByID(movieId, movie)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	if !ctl.authorizeMovie(c, movie, currentUser, movieActionEdit) {
+		return
+	}
+	if !ctl.checkIfMatch(c, movie) {
+		return
+	}
+
+	before := *movie
+	movie.Translations = change(append([]movies.MovieTranslation{}, movie.Translations...))
+	if err = ctl.mr.SaveMovieWithRevision(&before, movie, currentUser); err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while updating movie", err.Error())
+		return
+	}
+
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
+	HTTPRes(c, http.StatusOK, msg, movie.Translations)
+}
+
+// findMovie loads the movie of the id route parameter, responding with an error if it can't
+func (ctl *moviesController) findMovie(c *gin.Context) (*movies.Movie, bool) {
+	movieId := c.Param("id")
+	if movieId == "" {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie ID not provided")
+		return nil, false
+	}
+	movie := &movies.Movie{}
+	err := mgm.Coll(movie).FindByID(movieId, movie)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+			return nil, false
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return nil, false
+	}
+	return movie, true
+}
+
+// findCollaborator loads the user a movie is shared with or transferred to
+func (ctl *moviesController) findCollaborator(c *gin.Context) (*users.User, bool) {
+	var collaboratorInput movies.CollaboratorInput
+	if err := c.ShouldBindJSON(&collaboratorInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return nil, false
+	}
+	if err := conform.Struct(context.Background(), &collaboratorInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return nil, false
+	}
+	user, err := ctl.ur.FindByEmail(collaboratorInput.Email)
+	if err != nil {
+		if err == usersrepo.ErrUserNotFound {
+			HTTPRes(c, http.StatusNotFound, "User not found", nil)
+			return nil, false
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting user", err.Error())
+		return nil, false
+	}
+	return user, true
+}
+
+func (ctl *moviesController) ListCollaborators(c *gin.Context) {
+	currentUser := c.MustGet("user").(*users.User)
+	movie, ok := ctl.findMovie(c)
+	if !ok || !ctl.authorizeMovie(c, movie, currentUser, movieActionEdit) {
+		return
+	}
+
+	collaborators, err := ctl.mr.ListCollaborators(movie)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting collaborators", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "Movie collaborators", collaborators)
+}
+
+// AddCollaborator grants a user editor rights on the movie
+func (ctl *moviesController) AddCollaborator(c *gin.Context) {
+	currentUser := c.MustGet("user").(*users.User)
+	movie, ok := ctl.findMovie(c)
+	if !ok || !ctl.authorizeMovie(c, movie, currentUser, movieActionManage) || !ctl.checkIfMatch(c, movie) {
+		return
+	}
+	collaborator, ok := ctl.findCollaborator(c)
+	if !ok {
+		return
+	}
+	if collaborator.ID == movie.AddedBy {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "User already owns the movie")
+		return
+	}
+
+	if err := ctl.mr.AddEditor(movie, collaborator); err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while adding collaborator", err.Error())
+		return
+	}
+	collaborators, err := ctl.mr.ListCollaborators(movie)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting collaborators", err.Error())
+		return
+	}
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
+	HTTPRes(c, http.StatusOK, "Collaborator added", collaborators)
+}
+
+// RemoveCollaborator revokes the editor rights of a user, editors may remove themselves
+func (ctl *moviesController) RemoveCollaborator(c *gin.Context) {
+	currentUser := c.MustGet("user").(*users.User)
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	userId, err := primitive.ObjectIDFromHex(c.Param("user"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid user ID")
+		return
+	}
+	if userId != currentUser.ID && !ctl.authorizeMovie(c, movie, currentUser, movieActionManage) {
+		return
+	}
+	if !ctl.checkIfMatch(c, movie) {
+		return
+	}
+
+	if err := ctl.mr.RemoveEditor(movie, userId); err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while removing collaborator", err.Error())
+		return
+	}
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
+	HTTPRes(c, http.StatusOK, "Collaborator removed", nil)
+}
+
+// TransferOwnership makes another user the owner of the movie, the previous owner becoming an editor
+func (ctl *moviesController) TransferOwnership(c *gin.Context) {
+	currentUser := c.MustGet("user").(*users.User)
+	movie, ok := ctl.findMovie(c)
+	if !ok || !ctl.authorizeMovie(c, movie, currentUser, movieActionManage) || !ctl.checkIfMatch(c, movie) {
+		return
+	}
+	newOwner, ok := ctl.findCollaborator(c)
+	if !ok {
+		return
+	}
+	if newOwner.ID == movie.AddedBy {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "User already owns the movie")
+		return
+	}
+
+	if err := ctl.mr.TransferOwnership(movie, newOwner); err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while transferring ownership", err.Error())
+		return
+	}
+	collaborators, err := ctl.mr.ListCollaborators(movie)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting collaborators", err.Error())
+		return
+	}
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
+	HTTPRes(c, http.StatusOK, "Ownership transferred", collaborators)
+}
+
+// SubmitMovie sends a draft or rejected movie for review by moderators
+func (ctl *moviesController) SubmitMovie(c *gin.Context) {
+	currentUser := c.MustGet("user").(*users.User)
+	movie, ok := ctl.findMovie(c)
+	if !ok || !ctl.authorizeMovie(c, movie, currentUser, movieActionEdit) {
+		return
+	}
+	ctl.setStatus(c, movie, []string{movies.StatusDraft, movies.StatusRejected}, movies.StatusPendingReview, "", "Movie submitted for review")
+}
+
+// ListModerationQueue lists the movies in a status, pending review by default
+func (ctl *moviesController) ListModerationQueue(c *gin.Context) {
+	opts, err := ctl.parseListOptions(c, c.Query("by"), c.Query("direction"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	if opts.status == "" {
+		opts.status = movies.StatusPendingReview
+	}
+
+	results := []movies.MovieInfo{}
+	err = mgm.Coll(&movies.Movie{}).SimpleAggregate(&results, ctl.getAggregationStages("", opts)...)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "List of movies", results)
+}
+
+func (ctl *moviesController) ApproveMovie(c *gin.Context) {
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	ctl.setStatus(c, movie, []string{movies.StatusPendingReview}, movies.StatusPublished, "", "Movie published")
+}
+
+func (ctl *moviesController) RejectMovie(c *gin.Context) {
+	var rejectInput movies.RejectMovieInput
+	if err := c.ShouldBindJSON(&rejectInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	if err := conform.Struct(context.Background(), &rejectInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	ctl.setStatus(c, movie, []string{movies.StatusPendingReview}, movies.StatusRejected, rejectInput.Reason, "Movie rejected")
+}
+
+func (ctl *moviesController) setStatus(c *gin.Context, movie *movies.Movie, from []string, to string, reason string, msg string) {
+	if err := ctl.mr.SetStatus(movie, from, to, reason); err != nil {
+		if err == moviesrepo.ErrInvalidTransition {
+			HTTPRes(c, http.StatusConflict, "Error changing movie status", "Movie must be "+strings.Join(from, " or ")+" to become "+to)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while changing movie status", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, msg, ctl.movieToOutput(c, movie))
+}
+
+// MergeMovies merges duplicate movies into the surviving one
+func (ctl *moviesController) MergeMovies(c *gin.Context) {
+	var mergeInput movies.MergeMoviesInput
+	if err := c.ShouldBindJSON(&mergeInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+
+	survivorId, err := primitive.ObjectIDFromHex(mergeInput.SurvivorID)
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid survivor ID "+mergeInput.SurvivorID)
+		return
+	}
+	var duplicateIds []primitive.ObjectID
+	listed := map[primitive.ObjectID]bool{}
+	for _, rawId := range mergeInput.DuplicateIDs {
+		duplicateId, err := primitive.ObjectIDFromHex(rawId)
+		if err != nil {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid duplicate ID "+rawId)
+			return
+		}
+		if duplicateId == survivorId {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "A movie cannot be merged into itself")
+			return
+		}
+		if listed[duplicateId] {
+			continue
+		}
+		listed[duplicateId] = true
+		duplicateIds = append(duplicateIds, duplicateId)
+	}
+
+	survivor := &movies.Movie{}
+	if err := mgm.Coll(survivor).FindByID(survivorId, survivor); err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not found", mergeInput.SurvivorID)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	var duplicates []*movies.Movie
+	for _, duplicateId := range duplicateIds {
+		duplicate := &movies.Movie{}
+		if err := mgm.Coll(duplicate).FindByID(duplicateId, duplicate); err != nil {
+			if err == mongo.ErrNoDocuments {
+				HTTPRes(c, http.StatusNotFound, "Movie not found", duplicateId.Hex())
+				return
+			}
+			HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+			return
+		}
+		duplicates = append(duplicates, duplicate)
+	}
+
+	result, err := ctl.mr.MergeMovies(survivor, duplicates)
+	if err != nil {
+		// The merge is not rolled back, so report what was applied before it failed
+		HTTPRes(c, http.StatusInternalServerError, "Failed while merging movies", gin.H{"error": err.Error(), "result": result})
+		return
+	}
+
+	info := []movies.MovieInfo{}
+	err = mgm.Coll(survivor).SimpleAggregate(&info, ctl.getAggregationStages(survivor.ID.Hex(), nil)...)
+	if err != nil || len(info) == 0 {
+		HTTPRes(c, http.StatusOK, "Movies merged", gin.H{"result": result})
+		return
+	}
+	HTTPRes(c, http.StatusOK, "Movies merged", gin.H{"result": result, "movie": info[0]})
+}
+
+func (ctl *moviesController) GetMovieHistory(c *gin.Context) {
+	movieId := c.Param("id")
+	if movieId == "" {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie ID not provided")
+		return
+	}
+
+	movie := &movies.Movie{}
+	err := mgm.Coll(movie).FindByID(movieId, movie)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	if !movie.CanView(c.MustGet("user").(*users.User)) {
+		HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+		return
+	}
+
+	revisions, err := ctl.mr.ListRevisions(movie)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie history", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "Movie history", revisions)
+}
+
+func (ctl *moviesController) RevertMovie(c *gin.Context) {
+	movieId := c.Param("id")
+	if movieId == "" {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie ID not provided")
+		return
+	}
+	rev, err := strconv.Atoi(c.Param("rev"))
+	if err != nil || rev < 1 {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid revision number")
+		return
+	}
+
+	currentUser := c.MustGet("user").(*users.User)
+	movie := &movies.Movie{}
+	err = mgm.Coll(movie).FindByID(movieId, movie)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	if !ctl.authorizeMovie(c, movie, currentUser, movieActionEdit) {
+		return
+	}
+	if !ctl.checkIfMatch(c, movie) {
+		return
+	}
+
+	revision, err := ctl.mr.GetRevision(movie, rev)
+	if err != nil {
+		if err == moviesrepo.ErrRevisionNotFound {
+			HTTPRes(c, http.StatusNotFound, "Revision not found", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie revision", err.Error())
+		return
+	}
+
+	if err = ctl.mr.RevertRevision(movie, revision, currentUser); err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while reverting movie", err.Error())
+		return
+	}
+
+	output := ctl.movieToOutput(c, movie)
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
+	HTTPRes(c, http.StatusOK, "Movie reverted", output)
+}
+
+func (ctl *moviesController) updateMovieInputToMovie(input movies.UpdateMovieInput, output *movies.Movie) error {
+	if err := conform.Struct(context.Background(), &input); err != nil {
+		return err
+	}
+	originalLanguage, err := movies.ParseLanguage(input.OriginalLanguage)
+	if err != nil {
+		return err
+	}
+	output.Name = input.Name
+	output.Description = input.Description
+	output.Date = input.Date
+	output.OriginalLanguage = originalLanguage
+
+	return nil
+}
+
+// PatchMovie applies a JSON Merge Patch (RFC 7396) or a JSON Patch (RFC 6902)
+// to the movie, then validates and normalizes the patched result like AddMovie does
+func (ctl *moviesController) PatchMovie(c *gin.Context) {
+	movieId := c.Param("id")
+	if movieId == "" {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie ID not provided")
+		return
+	}
+
+	body, err := ioutil.ReadAll(c.Request.Body)
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+
+	currentUser := c.MustGet("user").(*users.User)
 	movie := &movies.Movie{}
-	err := mgm.Coll(movie).FindByID(movieId, movie)
+	err = mgm.Coll(movie).FindByID(movieId, movie)
 	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+			return
+		}
 		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
 		return
 	}
-	err = c.SaveUploadedFile(uploadCoverInput.Cover, "/opt/go-app/covers/"+movieId+".jpg")
-	if err != nil {
-		HTTPRes(c, http.StatusBadRequest, "File upload error", err.Error())
+	if !ctl.authorizeMovie(c, movie, currentUser, movieActionEdit) {
 		return
 	}
-	HTTPRes(c, http.StatusOK, "Cover uploaded", nil)
-}
-
-func (ctl *moviesController) UpdateMovie(c *gin.Context) {
-	var movieInput movies.UpdateMovieInput
-	if err := c.ShouldBindJSON(&movieInput); err != nil {
-		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+	if !ctl.checkIfMatch(c, movie) {
 		return
 	}
 
-	movieId := c.Param("id")
-	if movieId == "" {
-		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie ID not provided")
+	original, err := json.Marshal(movies.AddMovieInput{
+		Name:             movie.Name,
+		Description:      movie.Description,
+		Date:             movie.Date,
+		OriginalLanguage: movie.OriginalLanguage,
+	})
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error patching movie", err.Error())
 		return
 	}
 
-	currentUser := c.MustGet("user").(*users.User)
-	movie := &movies.Movie{}
-	err := mgm.Coll(movie).FindByID(movieId, movie)
+	var patched []byte
+	switch c.ContentType() {
+	case "application/merge-patch+json":
+		patched, err = jsonpatch.MergePatch(original, body)
+	case "application/json-patch+json":
+		var patch jsonpatch.Patch
+		patch, err = jsonpatch.DecodePatch(body)
+		if err == nil {
+			patched, err = patch.Apply(original)
+		}
+	default:
+		HTTPRes(c, http.StatusUnsupportedMediaType, "Unsupported patch format",
+			"Use application/merge-patch+json or application/json-patch+json")
+		return
+	}
 	if err != nil {
-		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		if errors.Is(err, jsonpatch.ErrTestFailed) {
+			HTTPRes(c, http.StatusConflict, "Patch test failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusBadRequest, "Invalid patch", err.Error())
 		return
 	}
-	if movie.AddedBy != currentUser.ID {
-		HTTPRes(c, http.StatusForbidden, "Error updating movie info", "Movie is not owned by current user")
+
+	var movieInput movies.AddMovieInput
+	decoder := json.NewDecoder(bytes.NewReader(patched))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&movieInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
 		return
 	}
-	err = ctl.updateMovieInputToMovie(movieInput, movie)
+	if err := binding.Validator.ValidateStruct(&movieInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	if err := conform.Struct(context.Background(), &movieInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	originalLanguage, err := movies.ParseLanguage(movieInput.OriginalLanguage)
 	if err != nil {
 		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
 		return
 	}
 
-	err = mgm.Coll(movie).Update(movie)
-	if err != nil {
+	before := *movie
+	movie.Name = movieInput.Name
+	movie.Description = movieInput.Description
+	movie.Date = movieInput.Date
+	movie.OriginalLanguage = originalLanguage
+	if err = ctl.mr.SaveMovieWithRevision(&before, movie, currentUser); err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
 		HTTPRes(c, http.StatusInternalServerError, "Failed while updating movie", err.Error())
 		return
 	}
 
-	_ = mgm.Coll(movie).FindByID(movieId, movie)
-	output := ctl.movieToOutput(movie)
+	output := ctl.movieToOutput(c, movie)
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
 	HTTPRes(c, http.StatusOK, "Movie Updated", output)
 }
 
-func (ctl *moviesController) updateMovieInputToMovie(input movies.UpdateMovieInput, output *movies.Movie) error {
-	if err := conform.Struct(context.Background(), &input); err != nil {
-		return err
-	}
-	output.Name = input.Name
-	output.Description = input.Description
-	output.Date = input.Date
-
-	return nil
-}
-
 func (ctl *moviesController) DeleteMovie(c *gin.Context) {
 	movieId := c.Param("id")
 	if movieId == "" {
@@ -172,15 +1106,31 @@ func (ctl *moviesController) DeleteMovie(c *gin.Context) {
 		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
 		return
 	}
-	if movie.AddedBy != currentUser.ID {
-		HTTPRes(c, http.StatusForbidden, "Error updating movie info", "Movie is not owned by current user")
+	if !ctl.authorizeMovie(c, movie, currentUser, movieActionManage) {
+		return
+	}
+	if !ctl.checkIfMatch(c, movie) {
 		return
 	}
-	err = mgm.Coll(movie).Delete(movie)
+	err = ctl.mr.DeleteMovie(movie)
 	if err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
 		HTTPRes(c, http.StatusInternalServerError, "Error deleting movie", err.Error())
 		return
 	}
+	// Files left behind if this fails are collected by the media GC
+	if movie.Cover != nil {
+		ctl.removeCoverFiles(c.Request.Context(), movie.Cover)
+	}
+	if movie.Video != nil {
+		_ = ctl.store.Delete(c.Request.Context(), movie.Video.Key)
+	}
+	for _, track := range movie.Subtitles {
+		_ = ctl.store.Delete(c.Request.Context(), track.Key)
+	}
 	HTTPRes(c, http.StatusOK, "Movie Deleted", nil)
 }
 func (ctl *moviesController) WatchMovie(c *gin.Context) {
@@ -197,6 +1147,10 @@ func (ctl *moviesController) WatchMovie(c *gin.Context) {
 		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
 		return
 	}
+	if !movie.CanView(currentUser) {
+		HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+		return
+	}
 	watchedEntry := movies.WatchedMovieEntry{MovieID: movie.ID, UserId: currentUser.ID}
 	if err = ctl.mr.AddToWatchedList(&watchedEntry); err != nil {
 		HTTPRes(c, http.StatusInternalServerError, "Error adding movie to watch list", err.Error())
@@ -205,6 +1159,198 @@ func (ctl *moviesController) WatchMovie(c *gin.Context) {
 	HTTPRes(c, http.StatusOK, "Movie added to watch list", nil)
 }
 
+// ReportProgress records the playback position of the current user on a movie. Past the watched
+// threshold, the movie is completed and added to the watched list.
+func (ctl *moviesController) ReportProgress(c *gin.Context) {
+	var progressInput movies.ProgressInput
+	if err := c.ShouldBindJSON(&progressInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if !movie.CanView(currentUser) {
+		HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+		return
+	}
+
+	progress, err := ctl.mr.FindProgress(movie.ID, currentUser.ID)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting playback progress", err.Error())
+		return
+	}
+	if progress == nil {
+		progress = &movies.PlaybackProgress{MovieID: movie.ID, UserID: currentUser.ID}
+	}
+	wasCompleted := progress.Completed
+	progress.Report(&progressInput, ctl.playback.WatchedThreshold)
+	if err = ctl.mr.SaveProgress(progress); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while saving playback progress", err.Error())
+		return
+	}
+	if progress.Completed && !wasCompleted {
+		watchedEntry := movies.WatchedMovieEntry{MovieID: movie.ID, UserId: currentUser.ID}
+		if err = ctl.mr.AddToWatchedList(&watchedEntry); err != nil {
+			HTTPRes(c, http.StatusInternalServerError, "Error adding movie to watch list", err.Error())
+			return
+		}
+	}
+	HTTPRes(c, http.StatusOK, "Playback progress saved", movies.NewProgressOutput(progress))
+}
+
+// continueWatchingLimit bounds the length of the "continue watching" row
+const continueWatchingLimit = 50
+
+// ListContinueWatching lists the movies the current user started and did not finish, most recently
+// played first. Movies left alone for more than the configured number of days are left out.
+// Progress is read in pages until the row is full, so movies deleted or hidden from the user
+// don't take up its places.
+func (ctl *moviesController) ListContinueWatching(c *gin.Context) {
+	currentUser := c.MustGet("user").(*users.User)
+	since := time.Now().UTC().AddDate(0, 0, -ctl.playback.ContinueWatchingDays)
+	row := []movies.MovieInfo{}
+	// Duplicate progress entries stored before the unique index existed are listed once
+	listed := map[primitive.ObjectID]bool{}
+	for skip := int64(0); len(row) < continueWatchingLimit; skip += continueWatchingLimit {
+		inProgress, err := ctl.mr.ListInProgress(currentUser.ID, since, skip, continueWatchingLimit)
+		if err != nil {
+			HTTPRes(c, http.StatusInternalServerError, "Error getting playback progress", err.Error())
+			return
+		}
+		ids := []primitive.ObjectID{}
+		byMovie := map[primitive.ObjectID]*movies.PlaybackProgress{}
+		for i := range inProgress {
+			if listed[inProgress[i].MovieID] {
+				continue
+			}
+			listed[inProgress[i].MovieID] = true
+			ids = append(ids, inProgress[i].MovieID)
+			byMovie[inProgress[i].MovieID] = &inProgress[i]
+		}
+		page, err := ctl.listMoviesByID(c, currentUser, ids)
+		if err != nil {
+			HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+			return
+		}
+		for i := range page {
+			page[i].Progress = movies.NewProgressOutput(byMovie[page[i].ID])
+		}
+		row = append(row, page...)
+		if len(inProgress) < continueWatchingLimit {
+			break
+		}
+	}
+	if len(row) > continueWatchingLimit {
+		row = row[:continueWatchingLimit]
+	}
+	c.Header("Vary", "Accept-Language")
+	HTTPRes(c, http.StatusOK, "Continue watching", row)
+}
+
+// listMoviesByID returns the info of the movies, in the order of ids. Movies deleted or
+// the user can't see are left out.
+func (ctl *moviesController) listMoviesByID(c *gin.Context, user *users.User, ids []primitive.ObjectID) ([]movies.MovieInfo, error) {
+	results := []movies.MovieInfo{}
+	if len(ids) > 0 {
+		err := mgm.Coll(&movies.Movie{}).SimpleAggregate(
+			&results,
+			ctl.getAggregationStages("", &listOptions{viewer: user, ids: ids})...,
+		)
+		if err != nil {
+			return nil, err
+		}
+	}
+	byID := map[primitive.ObjectID]*movies.MovieInfo{}
+	for i := range results {
+		byID[results[i].ID] = &results[i]
+	}
+	preferred := preferredLanguages(c)
+	ordered := []movies.MovieInfo{}
+	for _, id := range ids {
+		info, ok := byID[id]
+		if !ok {
+			continue
+		}
+		localizeMovie(info, preferred)
+		ctl.withMediaURLs(c, info)
+		ordered = append(ordered, *info)
+	}
+	return ordered, ctl.withWatchlistFlags(c, ordered)
+}
+
+// DismissContinueWatching removes a movie from the "continue watching" row of the current user,
+// until its playback is reported again
+func (ctl *moviesController) DismissContinueWatching(c *gin.Context) {
+	movieID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid movie ID")
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if err = ctl.mr.DismissProgress(movieID, currentUser.ID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not in progress", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while dismissing movie", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "Movie dismissed", nil)
+}
+
+// StreamMovie serves the video of the movie with range requests, so players can seek in it.
+// Playback starting from the beginning adds the movie to the watched list.
+func (ctl *moviesController) StreamMovie(c *gin.Context) {
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if !movie.CanView(currentUser) {
+		HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+		return
+	}
+	if movie.Video == nil {
+		HTTPRes(c, http.StatusNotFound, "Movie has no video", nil)
+		return
+	}
+
+	// Multipart responses are of no use to players, so only single ranges are served
+	rangeHeader := c.GetHeader("Range")
+	if strings.Contains(rangeHeader, ",") {
+		c.Header("Content-Range", "bytes */"+strconv.FormatInt(movie.Video.Size, 10))
+		HTTPRes(c, http.StatusRequestedRangeNotSatisfiable, "Range Not Satisfiable", "Multiple ranges are not supported")
+		return
+	}
+
+	blob, err := ctl.store.Open(c.Request.Context(), movie.Video.Key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			HTTPRes(c, http.StatusNotFound, "Movie has no video", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error reading video", err.Error())
+		return
+	}
+	defer blob.Close()
+
+	if c.Request.Method == http.MethodGet && (rangeHeader == "" || strings.HasPrefix(rangeHeader, "bytes=0-")) {
+		watchedEntry := movies.WatchedMovieEntry{MovieID: movie.ID, UserId: currentUser.ID}
+		if err = ctl.mr.AddToWatchedList(&watchedEntry); err != nil {
+			log.Printf("unable to record watch of movie %s: %v", movie.ID.Hex(), err)
+		}
+	}
+
+	// Video keys are unique per upload, so they identify the video for If-Range requests
+	c.Header("ETag", `"`+strings.TrimSuffix(path.Base(movie.Video.Key), path.Ext(movie.Video.Key))+`"`)
+	c.Header("Content-Type", movie.Video.ContentType)
+	c.Header("Cache-Control", "private")
+	http.ServeContent(c.Writer, c.Request, "", movie.Video.UploadedAt, blob)
+}
+
 func (ctl *moviesController) ReviewMovie(c *gin.Context) {
 	var reviewInput movies.ReviewMovieInput
 	if err := c.ShouldBindJSON(&reviewInput); err != nil {
@@ -230,6 +1376,10 @@ func (ctl *moviesController) ReviewMovie(c *gin.Context) {
 		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
 		return
 	}
+	if !movie.CanView(currentUser) {
+		HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+		return
+	}
 
 	watchedMovie, err := ctl.mr.DidWatchMovie(movie, currentUser)
 	if err != nil {
@@ -270,16 +1420,95 @@ func (ctl *moviesController) reviewMovieInputToReviewMovieEntry(input movies.Rev
 	}, nil
 }
 
-func (ctl *moviesController) ListWatchedMovies(c *gin.Context) {
+// invalidWatchedDate describes an invalid bound of the watched date range
+func invalidWatchedDate(param string, value string) string {
+	return "invalid " + param + " watched date " + strconv.Quote(value) + ", expected YYYY, YYYY-MM or YYYY-MM-DD"
+}
 
+// ListWatchedMovies lists a page of the movies the current user watched, most recently watched first,
+// along with their rating and the rating of the user. The from and to query parameters keep movies
+// watched within a period, i.e. ?from=2021-03&to=2021-06. Movies deleted since are left out.
+func (ctl *moviesController) ListWatchedMovies(c *gin.Context) {
 	currentUser := c.MustGet("user").(*users.User)
+	skip, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+	match := bson.M{"user_id": currentUser.ID}
+	watchedAt := bson.M{}
+	if from := c.Query("from"); from != "" {
+		watchedFrom, err := movies.ParseReleaseDate(from)
+		if err != nil {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", invalidWatchedDate("from", from))
+			return
+		}
+		watchedAt[operator.Gte] = watchedFrom.Time
+	}
+	if to := c.Query("to"); to != "" {
+		watchedTo, err := movies.ParseReleaseDate(to)
+		if err != nil {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", invalidWatchedDate("to", to))
+			return
+		}
+		watchedAt[operator.Lt] = watchedTo.End
+	}
+	if len(watchedAt) > 0 {
+		match["updated_at"] = watchedAt
+	}
 
-	// TODO: aggregate to get movie details
-	watchedMovies := []movies.WatchedMovieEntry{}
-	_ = mgm.Coll(&movies.WatchedMovieEntry{}).SimpleFind(&watchedMovies, bson.M{"user_id": currentUser.ID})
-
-	HTTPRes(c, http.StatusOK, "Watched Movies", watchedMovies)
+	// Movies are joined with the stages of the other listings, so they get their rating,
+	// and those the user can no longer see are left out like deleted ones
+	movieStages := append(
+		[]interface{}{bson.M{operator.Match: bson.M{operator.Expr: bson.M{operator.Eq: bson.A{"$_id", "$$movie_id"}}}}},
+		ctl.getAggregationStages("", &listOptions{viewer: currentUser})...,
+	)
+	results := []movies.WatchedMovieInfo{}
+	err := mgm.Coll(&movies.WatchedMovieEntry{}).SimpleAggregate(
+		&results,
+		bson.M{operator.Match: match},
+		bson.M{operator.Sort: bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: 1}}},
+		bson.M{operator.Lookup: bson.M{
+			"from":     mgm.Coll(&movies.Movie{}).Name(),
+			"let":      bson.M{"movie_id": "$movie_id"},
+			"pipeline": movieStages,
+			"as":       "movie",
+		}},
+		bson.M{operator.Unwind: "$movie"},
+		bson.M{operator.Skip: skip},
+		bson.M{operator.Limit: limit},
+		bson.M{operator.Lookup: bson.M{
+			"from": mgm.Coll(&movies.ReviewMovieEntry{}).Name(),
+			"let":  bson.M{"movie_id": "$movie_id"},
+			"pipeline": bson.A{bson.M{operator.Match: bson.M{
+				"user_id":     currentUser.ID,
+				operator.Expr: bson.M{operator.Eq: bson.A{"$movie_id", "$$movie_id"}},
+			}}},
+			"as": "my_review",
+		}},
+		bson.M{operator.Set: bson.M{"my_rating": bson.M{operator.First: "$my_review.rating"}}},
+		bson.M{operator.Unset: "my_review"},
+	)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting watched movies", err.Error())
+		return
+	}
 
+	preferred := preferredLanguages(c)
+	infos := make([]movies.MovieInfo, len(results))
+	for i := range results {
+		localizeMovie(&results[i].Movie, preferred)
+		ctl.withMediaURLs(c, &results[i].Movie)
+		infos[i] = results[i].Movie
+	}
+	if err = ctl.withWatchlistFlags(c, infos); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting watchlist", err.Error())
+		return
+	}
+	for i := range results {
+		results[i].Movie.InMyList = infos[i].InMyList
+	}
+	c.Header("Vary", "Accept-Language")
+	HTTPRes(c, http.StatusOK, "Watched Movies", results)
 }
 
 func (ctl *moviesController) checkValidParameter(value string, valid []string) bool {
@@ -290,44 +1519,203 @@ func (ctl *moviesController) checkValidParameter(value string, valid []string) b
 	}
 	return false
 }
-func (ctl *moviesController) ListMovies(c *gin.Context) {
-	sortBy := strings.ToLower(c.Param("by"))
-	direction := strings.ToLower(c.Param("direction"))
+
+// listOptions holds the sorting and filters of a movie listing
+type listOptions struct {
+	sortBy    string
+	direction int8
+	// releasedFrom and releasedTo keep movies whose release period overlaps theirs
+	releasedFrom *movies.ReleaseDate
+	releasedTo   *movies.ReleaseDate
+	// search matches the original or any localized name
+	search string
+	// status keeps movies in this status only
+	status string
+	// viewer is the current user, nil when anonymous, movies they can't see are left out
+	viewer *users.User
+	// ids keeps these movies only
+	ids []primitive.ObjectID
+}
+
+// parseListOptions validates the listing options shared by ListMovies and ExportMovies
+func (ctl *moviesController) parseListOptions(c *gin.Context, sortBy string, direction string) (*listOptions, error) {
+	sortBy = strings.ToLower(sortBy)
+	direction = strings.ToLower(direction)
 
 	if sortBy == "" {
 		if direction != "" {
-			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid soring method")
-			return
+			return nil, errors.New("Invalid soring method")
 		}
 		sortBy = "name"
 		direction = "desc"
 	}
 	if ctl.checkValidParameter(sortBy, []string{"name", "date", "rating"}) == false ||
 		ctl.checkValidParameter(direction, []string{"asc", "desc"}) == false {
-		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid soring method")
-		return
+		return nil, errors.New("Invalid soring method")
 	}
-	var sortByOption int8
+	opts := &listOptions{sortBy: sortBy, direction: -1}
 	if direction == "asc" {
-		sortByOption = 1
-	} else {
-		sortByOption = -1
+		opts.direction = 1
+	}
+
+	if from := c.Query("from"); from != "" {
+		releasedFrom, err := movies.ParseReleaseDate(from)
+		if err != nil {
+			return nil, err
+		}
+		opts.releasedFrom = &releasedFrom
+	}
+	if to := c.Query("to"); to != "" {
+		releasedTo, err := movies.ParseReleaseDate(to)
+		if err != nil {
+			return nil, err
+		}
+		opts.releasedTo = &releasedTo
+	}
+	opts.search = strings.TrimSpace(c.Query("q"))
+	opts.status = strings.ToLower(c.Query("status"))
+	if opts.status != "" && ctl.checkValidParameter(opts.status, movieStatuses) == false {
+		return nil, errors.New("Invalid movie status")
+	}
+	opts.viewer = optionalUser(c)
+	return opts, nil
+}
+
+var movieStatuses = []string{movies.StatusDraft, movies.StatusPendingReview, movies.StatusPublished, movies.StatusRejected}
+
+// publishedFilter matches published movies, including the ones stored before statuses existed
+var publishedFilter = bson.M{"status": bson.M{operator.In: bson.A{movies.StatusPublished, nil}}}
+
+// filters returns the match conditions of the listing.
+// Movies stored before release periods existed have no date_end and are matched by their date.
+func (opts *listOptions) filters() bson.A {
+	filters := bson.A{}
+	switch {
+	case opts.viewer == nil:
+		filters = append(filters, publishedFilter)
+	case !opts.viewer.HasRole(users.RoleModerator):
+		filters = append(filters, bson.M{operator.Or: bson.A{
+			publishedFilter,
+			bson.M{"added_by": opts.viewer.ID},
+			bson.M{"editors": opts.viewer.ID},
+		}})
+	}
+	if opts.ids != nil {
+		filters = append(filters, bson.M{"_id": bson.M{operator.In: opts.ids}})
+	}
+	if opts.status == movies.StatusPublished {
+		filters = append(filters, publishedFilter)
+	} else if opts.status != "" {
+		filters = append(filters, bson.M{"status": opts.status})
+	}
+	if opts.releasedFrom != nil {
+		filters = append(filters, bson.M{operator.Or: bson.A{
+			bson.M{"date_end": bson.M{operator.Gt: opts.releasedFrom.Time}},
+			bson.M{"date_end": nil, "date": bson.M{operator.Gte: opts.releasedFrom.Time}},
+		}})
+	}
+	if opts.releasedTo != nil {
+		filters = append(filters, bson.M{"date": bson.M{operator.Lt: opts.releasedTo.End}})
+	}
+	if opts.search != "" {
+		pattern := primitive.Regex{Pattern: regexp.QuoteMeta(opts.search), Options: "i"}
+		filters = append(filters, bson.M{operator.Or: bson.A{
+			bson.M{"name": pattern},
+			bson.M{"translations.name": pattern},
+		}})
+	}
+	return filters
+}
+
+func (ctl *moviesController) ListMovies(c *gin.Context) {
+	opts, err := ctl.parseListOptions(c, c.Param("by"), c.Param("direction"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
 	}
 
 	results := []movies.MovieInfo{}
-	err := mgm.Coll(&movies.Movie{}).SimpleAggregate(
+	err = mgm.Coll(&movies.Movie{}).SimpleAggregate(
 		&results,
-		ctl.getAggregationStages("", sortBy, sortByOption)...,
+		ctl.getAggregationStages("", opts)...,
 	)
 	if err != nil {
 		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
 		return
 	}
 
+	preferred := preferredLanguages(c)
+	for i := range results {
+		localizeMovie(&results[i], preferred)
+		ctl.withMediaURLs(c, &results[i])
+	}
+	if err = ctl.withWatchlistFlags(c, results); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting watchlist", err.Error())
+		return
+	}
+	c.Header("Vary", "Accept-Language")
 	HTTPRes(c, http.StatusOK, "List of movies", results)
 
 }
 
+// ExportMovies streams the whole catalog as CSV, JSON or NDJSON, sorted like ListMovies
+func (ctl *moviesController) ExportMovies(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "json"))
+	if ctl.checkValidParameter(format, []string{"csv", "json", "ndjson"}) == false {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Export format must be csv, json or ndjson")
+		return
+	}
+	opts, err := ctl.parseListOptions(c, c.Query("by"), c.Query("direction"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	cursor, err := mgm.Coll(&movies.Movie{}).Aggregate(
+		ctx,
+		ctl.getAggregationStages("", opts),
+		options.Aggregate().SetAllowDiskUse(true),
+	)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error exporting movies", err.Error())
+		return
+	}
+	defer cursor.Close(ctx)
+
+	writer := newExportWriter(format, c.Writer)
+	c.Header("Content-Type", writer.contentType())
+	c.Header("Content-Disposition", `attachment; filename="movies.`+format+`"`)
+	c.Status(http.StatusOK)
+
+	// Once streaming has started the status can no longer change,
+	// so failures are logged and the response is cut short
+	if err = writer.begin(); err != nil {
+		log.Println("export:", err)
+		return
+	}
+	for count := 1; cursor.Next(ctx); count++ {
+		row := movies.MovieExport{}
+		if err = cursor.Decode(&row); err == nil {
+			err = writer.write(&row)
+		}
+		if err != nil {
+			log.Println("export:", err)
+			return
+		}
+		if count%exportFlushEvery == 0 {
+			writer.flush()
+		}
+	}
+	if err = cursor.Err(); err != nil {
+		log.Println("export:", err)
+		return
+	}
+	if err = writer.end(); err != nil {
+		log.Println("export:", err)
+	}
+}
+
 func (ctl *moviesController) GetMovieInfo(c *gin.Context) {
 	movieId := c.Param("id")
 	if movieId == "" {
@@ -338,16 +1726,84 @@ func (ctl *moviesController) GetMovieInfo(c *gin.Context) {
 	results := []movies.MovieInfo{}
 	err := mgm.Coll(&movies.Movie{}).SimpleAggregate(
 		&results,
-		ctl.getAggregationStages(movieId, "", 0)...,
+		ctl.getAggregationStages(movieId, &listOptions{viewer: optionalUser(c)})...,
 	)
 	if err != nil {
 		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
 		return
 	}
+	if len(results) == 0 {
+		HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+		return
+	}
+	localizeMovie(&results[0], preferredLanguages(c))
+	ctl.withMediaURLs(c, &results[0])
+	if err = ctl.withStreamURLs(c, &results[0]); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	if currentUser := optionalUser(c); currentUser != nil {
+		progress, err := ctl.mr.FindProgress(results[0].ID, currentUser.ID)
+		if err != nil {
+			HTTPRes(c, http.StatusInternalServerError, "Error getting playback progress", err.Error())
+			return
+		}
+		results[0].Progress = movies.NewProgressOutput(progress)
+	}
+	if err = ctl.withWatchlistFlags(c, results); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting watchlist", err.Error())
+		return
+	}
+	c.Header("ETag", movies.ETag(results[0].UpdatedAt))
+	c.Header("Vary", "Accept-Language")
 	HTTPRes(c, http.StatusOK, "List of movies", results[0])
 }
 
-func (ctl *moviesController) getAggregationStages(movieId string, sortBy string, direction int8) []interface{} {
+// withMediaURLs fills in where the cover and subtitles of a listed movie are served
+func (ctl *moviesController) withMediaURLs(c *gin.Context, info *movies.MovieInfo) {
+	info.CoverURLs = ctl.coverURLs(c, info.ID, info.Cover, info.IsPublished())
+	info.CoverPlaceholder = info.Cover.Placeholder()
+	currentUser := optionalUser(c)
+	for i := range info.Subtitles {
+		if currentUser == nil {
+			// Subtitles are only served to signed in users
+			continue
+		}
+		info.Subtitles[i].URL = ctl.signer.Sign(subtitlesURL(info.ID.Hex(), info.Subtitles[i].Lang), currentUser)
+	}
+}
+
+// withStreamURLs fills in the signed URLs the video of the movie is played from, for signed in users
+func (ctl *moviesController) withStreamURLs(c *gin.Context, info *movies.MovieInfo) error {
+	currentUser := optionalUser(c)
+	if currentUser == nil {
+		return nil
+	}
+	renditions, err := ctl.mr.ListRenditions(&movies.Movie{DefaultModel: info.DefaultModel})
+	if err != nil {
+		return err
+	}
+	urls := &movies.StreamURLs{}
+	base := streamURL(info.ID.Hex())
+	if info.Video != nil {
+		urls.Video = ctl.signer.Sign(base, currentUser)
+	}
+	for _, rendition := range renditions {
+		if len(rendition.PlayableSegments()) == 0 {
+			continue
+		}
+		urls.HLS = ctl.signer.Sign(base+"master.m3u8", currentUser)
+		if rendition.Container == movies.ContainerFMP4 {
+			urls.DASH = ctl.signer.Sign(base+"manifest.mpd", currentUser)
+		}
+	}
+	if *urls != (movies.StreamURLs{}) {
+		info.StreamURLs = urls
+	}
+	return nil
+}
+
+func (ctl *moviesController) getAggregationStages(movieId string, opts *listOptions) []interface{} {
 	reviewsCollName := mgm.Coll(&movies.ReviewMovieEntry{}).Name()
 
 	lookupStage := builder.Lookup(reviewsCollName, "_id", "movie_id", "reviews")
@@ -363,7 +1819,7 @@ func (ctl *moviesController) getAggregationStages(movieId string, sortBy string,
 					},
 				},
 			},
-			"ratingsCount": bson.M{
+			"reviews_count": bson.M{
 				operator.Size: "$reviews",
 			},
 		},
@@ -374,10 +1830,10 @@ func (ctl *moviesController) getAggregationStages(movieId string, sortBy string,
 			"rating": bson.M{
 				operator.Cond: bson.M{
 					"if": bson.M{
-						operator.Gt: bson.A{"$ratingsCount", 0},
+						operator.Gt: bson.A{"$reviews_count", 0},
 					},
 					"then": bson.M{
-						operator.Divide: bson.A{"$ratingsTotal", "$ratingsCount"},
+						operator.Divide: bson.A{"$ratingsTotal", "$reviews_count"},
 					},
 					"else": 0,
 				},
@@ -392,7 +1848,7 @@ func (ctl *moviesController) getAggregationStages(movieId string, sortBy string,
 		}
 
 	unsetStage :=
-		bson.M{operator.Unset: bson.A{"ratingsCount", "ratingsTotal"}}
+		bson.M{operator.Unset: bson.A{"reviews", "ratingsTotal"}}
 
 	var stages []interface{}
 	if movieId != "" {
@@ -400,12 +1856,22 @@ func (ctl *moviesController) getAggregationStages(movieId string, sortBy string,
 		matchStage := bson.M{operator.Match: bson.M{"_id": movieHex}}
 		stages = append(stages, matchStage)
 	}
+	if opts != nil {
+		if filters := opts.filters(); len(filters) > 0 {
+			stages = append(stages, bson.M{operator.Match: bson.M{operator.And: filters}})
+		}
+	}
 
 	stages = append(stages, lookupStage, countRatingsStage, averageRatingsStage, roundingStage, unsetStage)
 
-	if sortBy != "" {
-		sortStage := bson.M{operator.Sort: bson.M{sortBy: direction}}
-		stages = append(stages, sortStage)
+	if opts != nil && opts.sortBy != "" {
+		sort := bson.D{{Key: opts.sortBy, Value: opts.direction}}
+		if opts.sortBy == "date" {
+			// Movies starting on the same day are ordered by the end of their release period
+			sort = append(sort, bson.E{Key: "date_end", Value: opts.direction})
+		}
+		sort = append(sort, bson.E{Key: "_id", Value: 1})
+		stages = append(stages, bson.M{operator.Sort: sort})
 	}
 
 	return stages
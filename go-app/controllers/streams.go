@@ -0,0 +1,316 @@
+package controllers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/kamva/mgm/v3"
+	"go-app/definitions/movies"
+	"go-app/definitions/users"
+	"go-app/mediaurls"
+	"go-app/repositories/moviesrepo"
+	"go-app/storage"
+	"go-app/streaming"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StreamsController interface, serving movies as adaptive HLS and DASH streams
+type StreamsController interface {
+	SaveRendition(*gin.Context)
+	DeleteRendition(*gin.Context)
+	UploadSegment(*gin.Context)
+	HLSMaster(*gin.Context)
+	HLSPlaylist(*gin.Context)
+	DASHManifest(*gin.Context)
+	ServeSegment(*gin.Context)
+}
+
+type streamsController struct {
+	mr     moviesrepo.Repo
+	store  storage.Storage
+	signer *mediaurls.Signer
+}
+
+// NewStreamsController instantiates Streams Controller
+func NewStreamsController(mr moviesrepo.Repo, store storage.Storage, signer *mediaurls.Signer) StreamsController {
+	return &streamsController{mr: mr, store: store, signer: signer}
+}
+
+// streamURL returns the URL the video of a movie is streamed from, which its manifests,
+// segments and subtitles are served under
+func streamURL(movieID string) string {
+	return "/movie/stream/" + movieID + "/"
+}
+
+// segmentMaxBytes bounds the size of uploaded segments, which last a few seconds
+const segmentMaxBytes = 64 << 20
+
+var (
+	renditionNamePattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+	// codecsPattern keeps codecs safe to quote in playlists and manifests
+	codecsPattern = regexp.MustCompile(`^[A-Za-z0-9.,+-]*$`)
+)
+
+// findMovie loads the movie of the request, checking the current user may see it,
+// or edit it when edit is set
+func (ctl *streamsController) findMovie(c *gin.Context, edit bool) (*movies.Movie, bool) {
+	movie := &movies.Movie{}
+	err := mgm.Coll(movie).FindByID(c.Param("id"), movie)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+			return nil, false
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return nil, false
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if !movie.CanView(currentUser) {
+		HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+		return nil, false
+	}
+	if edit && !movie.CanEdit(currentUser) {
+		HTTPRes(c, http.StatusForbidden, "Insufficient permissions", "Current user is not allowed to edit this movie")
+		return nil, false
+	}
+	return movie, true
+}
+
+// findRendition loads the rendition of the request, after checking access to its movie
+func (ctl *streamsController) findRendition(c *gin.Context, edit bool) (*movies.Movie, *movies.VideoRendition, bool) {
+	movie, ok := ctl.findMovie(c, edit)
+	if !ok {
+		return nil, nil, false
+	}
+	rendition, err := ctl.mr.FindRendition(movie, c.Param("rendition"))
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting rendition", err.Error())
+		return nil, nil, false
+	}
+	if rendition == nil {
+		HTTPRes(c, http.StatusNotFound, "Rendition not found", nil)
+		return nil, nil, false
+	}
+	return movie, rendition, true
+}
+
+// SaveRendition creates or updates a rendition of the video of a movie
+func (ctl *streamsController) SaveRendition(c *gin.Context) {
+	var renditionInput movies.RenditionInput
+	if err := c.ShouldBindJSON(&renditionInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	if err := conform.Struct(context.Background(), &renditionInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	name := c.Param("rendition")
+	if !renditionNamePattern.MatchString(name) {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Rendition name must be 1 to 32 lowercase letters, digits, - or _")
+		return
+	}
+	if !codecsPattern.MatchString(renditionInput.Codecs) {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid codecs")
+		return
+	}
+	movie, ok := ctl.findMovie(c, true)
+	if !ok {
+		return
+	}
+	rendition, err := ctl.mr.SaveRendition(movie, name, &renditionInput)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while saving rendition", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "Rendition saved", rendition)
+}
+
+// DeleteRendition deletes a rendition along with its segments
+func (ctl *streamsController) DeleteRendition(c *gin.Context) {
+	_, rendition, ok := ctl.findRendition(c, true)
+	if !ok {
+		return
+	}
+	if err := ctl.mr.DeleteRendition(rendition); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while deleting rendition", err.Error())
+		return
+	}
+	ctx := c.Request.Context()
+	if rendition.InitKey != "" {
+		_ = ctl.store.Delete(ctx, rendition.InitKey)
+	}
+	for _, segment := range rendition.Segments {
+		_ = ctl.store.Delete(ctx, segment.Key)
+	}
+	HTTPRes(c, http.StatusOK, "Rendition deleted", nil)
+}
+
+// UploadSegment stores a segment of a rendition, sent as the request body. Media segments
+// are named after their index and need their duration, i.e. PUT .../segments/12.ts?duration=6.006
+func (ctl *streamsController) UploadSegment(c *gin.Context) {
+	movie, rendition, ok := ctl.findRendition(c, true)
+	if !ok {
+		return
+	}
+	name := c.Param("segment")
+	index, isInit, ok := parseSegmentName(rendition, name)
+	if !ok {
+		HTTPRes(c, http.StatusNotFound, "Segment not found", nil)
+		return
+	}
+	duration := 0.0
+	if !isInit {
+		var err error
+		duration, err = strconv.ParseFloat(c.Query("duration"), 64)
+		if err != nil || duration <= 0 {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Segment duration must be a positive number of seconds")
+			return
+		}
+	}
+	size := c.Request.ContentLength
+	if size < 0 {
+		HTTPRes(c, http.StatusLengthRequired, "Length Required", "Content-Length header not provided")
+		return
+	}
+	if size > segmentMaxBytes {
+		HTTPRes(c, http.StatusRequestEntityTooLarge, "File upload error", "Segment is too large")
+		return
+	}
+
+	// Keys change on every upload, so players never get a segment mixed from two uploads
+	key := storage.StreamsPrefix + movie.ID.Hex() + "/" + rendition.Name + "/" +
+		strconv.FormatInt(time.Now().UnixNano(), 36) + "-" + name
+	err := ctl.store.Put(c.Request.Context(), key, c.Request.Body, size, streaming.SegmentContentType(rendition, name))
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while storing segment", err.Error())
+		return
+	}
+	previous := rendition.InitKey
+	if isInit {
+		err = ctl.mr.SetInitSegment(rendition, key)
+	} else {
+		previous = rendition.Segments[strconv.Itoa(index)].Key
+		err = ctl.mr.SetSegment(rendition, index, movies.VideoSegment{Key: key, Duration: duration, Size: size})
+	}
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while saving segment", err.Error())
+		return
+	}
+	if previous != "" {
+		_ = ctl.store.Delete(c.Request.Context(), previous)
+	}
+	HTTPRes(c, http.StatusOK, "Segment uploaded", nil)
+}
+
+// HLSMaster serves the HLS master playlist listing the renditions of a movie
+func (ctl *streamsController) HLSMaster(c *gin.Context) {
+	movie, ok := ctl.findMovie(c, false)
+	if !ok {
+		return
+	}
+	renditions, err := ctl.mr.ListRenditions(movie)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting renditions", err.Error())
+		return
+	}
+	if len(renditions) == 0 {
+		HTTPRes(c, http.StatusNotFound, "Movie has no renditions", nil)
+		return
+	}
+	ctl.serveManifest(c, streaming.HLSContentType, streaming.HLSMaster(renditions, ctl.link(c, movie)))
+}
+
+// HLSPlaylist serves the HLS media playlist of a rendition
+func (ctl *streamsController) HLSPlaylist(c *gin.Context) {
+	movie, rendition, ok := ctl.findRendition(c, false)
+	if !ok {
+		return
+	}
+	ctl.serveManifest(c, streaming.HLSContentType, streaming.HLSPlaylist(rendition, ctl.link(c, movie)))
+}
+
+// DASHManifest serves the DASH manifest of the fragmented MP4 renditions of a movie
+func (ctl *streamsController) DASHManifest(c *gin.Context) {
+	movie, ok := ctl.findMovie(c, false)
+	if !ok {
+		return
+	}
+	renditions, err := ctl.mr.ListRenditions(movie)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting renditions", err.Error())
+		return
+	}
+	manifest, err := streaming.DASHManifest(renditions, ctl.link(c, movie))
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error generating manifest", err.Error())
+		return
+	}
+	if manifest == nil {
+		HTTPRes(c, http.StatusNotFound, "Movie has no fragmented MP4 renditions", nil)
+		return
+	}
+	ctl.serveManifest(c, streaming.DASHContentType, manifest)
+}
+
+// link signs the URLs of manifests for the current user, so players can fetch them without a token
+func (ctl *streamsController) link(c *gin.Context, movie *movies.Movie) streaming.Link {
+	currentUser := c.MustGet("user").(*users.User)
+	return func(path string) string {
+		return ctl.signer.Sign(streamURL(movie.ID.Hex())+path, currentUser)
+	}
+}
+
+// serveManifest serves a generated manifest, which changes as segments are uploaded
+func (ctl *streamsController) serveManifest(c *gin.Context, contentType string, manifest []byte) {
+	c.Header("Cache-Control", "private, no-cache")
+	c.Data(http.StatusOK, contentType, manifest)
+}
+
+// ServeSegment serves a segment of a rendition. Access to the movie is checked for every segment,
+// so a playlist obtained once does not give access to the video.
+func (ctl *streamsController) ServeSegment(c *gin.Context) {
+	_, rendition, ok := ctl.findRendition(c, false)
+	if !ok {
+		return
+	}
+	name := c.Param("segment")
+	index, isInit, ok := parseSegmentName(rendition, name)
+	key := rendition.InitKey
+	if ok && !isInit {
+		key = rendition.Segments[strconv.Itoa(index)].Key
+	}
+	if !ok || key == "" {
+		HTTPRes(c, http.StatusNotFound, "Segment not found", nil)
+		return
+	}
+	blob, err := ctl.store.Open(c.Request.Context(), key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			HTTPRes(c, http.StatusNotFound, "Segment not found", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error reading segment", err.Error())
+		return
+	}
+	defer blob.Close()
+	c.Header("Content-Type", streaming.SegmentContentType(rendition, name))
+	c.Header("Cache-Control", "private")
+	http.ServeContent(c.Writer, c.Request, "", time.Time{}, blob)
+}
+
+// parseSegmentName returns the index of a media segment, or whether it is the initialization segment
+func parseSegmentName(rendition *movies.VideoRendition, name string) (index int, isInit bool, ok bool) {
+	if name == movies.InitSegmentName {
+		return 0, true, rendition.Container == movies.ContainerFMP4
+	}
+	index, err := strconv.Atoi(strings.SplitN(name, ".", 2)[0])
+	if err != nil || index < 0 || rendition.SegmentName(index) != name {
+		return 0, false, false
+	}
+	return index, false, true
+}
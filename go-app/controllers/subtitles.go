@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"bytes"
+	"github.com/gin-gonic/gin"
+	"go-app/definitions/movies"
+	"go-app/definitions/users"
+	"go-app/media"
+	"go-app/repositories/moviesrepo"
+	"go-app/storage"
+	"golang.org/x/text/language"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// subtitlesURL returns the URL a subtitle track of a movie is served at
+func subtitlesURL(movieID string, lang string) string {
+	return streamURL(movieID) + "subtitles/" + lang + "/"
+}
+
+// parseOffset parses the offset query parameter subtitles are shifted by, i.e. "-1.5s" or "300ms"
+func parseOffset(c *gin.Context) (time.Duration, bool) {
+	value := c.Query("offset")
+	if value == "" {
+		return 0, true
+	}
+	offset, err := time.ParseDuration(value)
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid offset, i.e. -1.5s or 300ms")
+		return 0, false
+	}
+	return offset, true
+}
+
+// UploadSubtitles adds or replaces the subtitles of a movie for a language. SRT and WebVTT files
+// are accepted and stored as WebVTT, shifted by the offset query parameter if they are out of sync.
+func (ctl *moviesController) UploadSubtitles(c *gin.Context) {
+	var uploadInput movies.UploadSubtitlesInput
+	if err := c.ShouldBind(&uploadInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	lang, err := language.Parse(c.Param("lang"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid language tag")
+		return
+	}
+	offset, ok := parseOffset(c)
+	if !ok {
+		return
+	}
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if !ctl.authorizeMovie(c, movie, currentUser, movieActionEdit) {
+		return
+	}
+	if !ctl.checkIfMatch(c, movie) {
+		return
+	}
+
+	if uploadInput.File.Size > media.SubtitlesMaxBytes {
+		HTTPRes(c, http.StatusRequestEntityTooLarge, "File upload error", "Subtitles file is too large")
+		return
+	}
+	file, err := uploadInput.File.Open()
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "File upload error", err.Error())
+		return
+	}
+	defer file.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(file, media.SubtitlesMaxBytes))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "File upload error", err.Error())
+		return
+	}
+	cues, err := media.ParseSubtitles(data)
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Invalid subtitles", err.Error())
+		return
+	}
+	cues = media.ShiftCues(cues, offset)
+	if len(cues) == 0 {
+		HTTPRes(c, http.StatusBadRequest, "Invalid subtitles", "No subtitles left after applying the offset")
+		return
+	}
+	vtt := media.WriteWebVTT(cues)
+
+	ctx := c.Request.Context()
+	track := movies.SubtitleTrack{
+		Lang:       lang.String(),
+		Key:        storage.SubtitlesPrefix + movie.ID.Hex() + "-" + lang.String() + "-" + strconv.FormatInt(time.Now().UnixNano(), 36) + ".vtt",
+		Cues:       len(cues),
+		UploadedAt: time.Now().UTC(),
+	}
+	if err = ctl.store.Put(ctx, track.Key, bytes.NewReader(vtt), int64(len(vtt)), media.WebVTTContentType); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while storing subtitles", err.Error())
+		return
+	}
+	previous := ""
+	tracks := []movies.SubtitleTrack{}
+	for _, existing := range movie.Subtitles {
+		if existing.Lang == track.Lang {
+			previous = existing.Key
+			continue
+		}
+		tracks = append(tracks, existing)
+	}
+	if err = ctl.mr.SetSubtitles(movie, append(tracks, track)); err != nil {
+		_ = ctl.store.Delete(ctx, track.Key)
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while updating movie", err.Error())
+		return
+	}
+	if previous != "" {
+		_ = ctl.store.Delete(ctx, previous)
+	}
+
+	track.URL = ctl.signer.Sign(subtitlesURL(movie.ID.Hex(), track.Lang), currentUser)
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
+	HTTPRes(c, http.StatusOK, "Subtitles uploaded", track)
+}
+
+// DeleteSubtitles removes the subtitles of a movie for a language
+func (ctl *moviesController) DeleteSubtitles(c *gin.Context) {
+	lang, err := language.Parse(c.Param("lang"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid language tag")
+		return
+	}
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if !ctl.authorizeMovie(c, movie, currentUser, movieActionEdit) {
+		return
+	}
+	if !ctl.checkIfMatch(c, movie) {
+		return
+	}
+
+	removed := ""
+	tracks := []movies.SubtitleTrack{}
+	for _, existing := range movie.Subtitles {
+		if existing.Lang == lang.String() {
+			removed = existing.Key
+			continue
+		}
+		tracks = append(tracks, existing)
+	}
+	if removed == "" {
+		HTTPRes(c, http.StatusNotFound, "Subtitles not found", nil)
+		return
+	}
+	if err = ctl.mr.SetSubtitles(movie, tracks); err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", err.Error())
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while updating movie", err.Error())
+		return
+	}
+	_ = ctl.store.Delete(c.Request.Context(), removed)
+
+	c.Header("ETag", movies.ETag(movie.UpdatedAt))
+	HTTPRes(c, http.StatusOK, "Subtitles deleted", nil)
+}
+
+// ServeSubtitles serves the WebVTT subtitles of a movie for a language,
+// shifted by the offset query parameter so players can resync them
+func (ctl *moviesController) ServeSubtitles(c *gin.Context) {
+	lang, err := language.Parse(c.Param("lang"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid language tag")
+		return
+	}
+	offset, ok := parseOffset(c)
+	if !ok {
+		return
+	}
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	if !movie.CanView(c.MustGet("user").(*users.User)) {
+		HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+		return
+	}
+	var track *movies.SubtitleTrack
+	for i := range movie.Subtitles {
+		if movie.Subtitles[i].Lang == lang.String() {
+			track = &movie.Subtitles[i]
+		}
+	}
+	if track == nil {
+		HTTPRes(c, http.StatusNotFound, "Subtitles not found", nil)
+		return
+	}
+
+	blob, err := ctl.store.Open(c.Request.Context(), track.Key)
+	if err != nil {
+		if err == storage.ErrNotFound {
+			HTTPRes(c, http.StatusNotFound, "Subtitles not found", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error reading subtitles", err.Error())
+		return
+	}
+	defer blob.Close()
+	vtt, err := ioutil.ReadAll(blob)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error reading subtitles", err.Error())
+		return
+	}
+	if offset != 0 {
+		cues, err := media.ParseSubtitles(vtt)
+		if err != nil {
+			HTTPRes(c, http.StatusInternalServerError, "Error reading subtitles", err.Error())
+			return
+		}
+		vtt = media.WriteWebVTT(media.ShiftCues(cues, offset))
+	}
+	c.Header("Cache-Control", "private")
+	c.Data(http.StatusOK, media.WebVTTContentType, vtt)
+}
@@ -0,0 +1,458 @@
+package controllers
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/kamva/mgm/v3"
+	"go-app/configs"
+	"go-app/definitions/movies"
+	"go-app/definitions/users"
+	"go-app/media"
+	"go-app/repositories/moviesrepo"
+	"go-app/storage"
+	"go.mongodb.org/mongo-driver/mongo"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// UploadsController interface, implementing the tus 1.0 resumable upload protocol
+// (https://tus.io/protocols/resumable-upload.html) for movie videos
+type UploadsController interface {
+	UploadOptions(*gin.Context)
+	CreateUpload(*gin.Context)
+	GetUploadOffset(*gin.Context)
+	PatchUpload(*gin.Context)
+	DeleteUpload(*gin.Context)
+}
+
+type uploadsController struct {
+	mr    moviesrepo.Repo
+	store storage.Storage
+	media configs.MediaConfig
+
+	// busy holds the uploads a request is currently writing to
+	mu   sync.Mutex
+	busy map[string]bool
+}
+
+// NewUploadsController instantiates Uploads Controller
+func NewUploadsController(mr moviesrepo.Repo, store storage.Storage, media configs.MediaConfig) UploadsController {
+	return &uploadsController{mr: mr, store: store, media: media, busy: map[string]bool{}}
+}
+
+const (
+	tusVersion    = "1.0.0"
+	tusExtensions = "creation,termination,checksum,expiration"
+	// tusOffsetContentType is the content type of PATCH requests
+	tusOffsetContentType = "application/offset+octet-stream"
+	// statusChecksumMismatch is the tus status of chunks not matching their Upload-Checksum
+	statusChecksumMismatch = 460
+)
+
+var errInvalidMetadata = errors.New("invalid upload metadata")
+
+// tusChecksums maps the supported Upload-Checksum algorithms to their hash
+var tusChecksums = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+// checkTusVersion requires the request to use the supported tus version
+func (ctl *uploadsController) checkTusVersion(c *gin.Context) bool {
+	c.Header("Tus-Resumable", tusVersion)
+	if c.GetHeader("Tus-Resumable") != tusVersion {
+		c.Header("Tus-Version", tusVersion)
+		HTTPRes(c, http.StatusPreconditionFailed, "Precondition Failed", "Unsupported tus version")
+		return false
+	}
+	return true
+}
+
+// UploadOptions describes the supported tus version and extensions
+func (ctl *uploadsController) UploadOptions(c *gin.Context) {
+	c.Header("Tus-Resumable", tusVersion)
+	c.Header("Tus-Version", tusVersion)
+	c.Header("Tus-Extension", tusExtensions)
+	c.Header("Tus-Max-Size", strconv.FormatInt(ctl.media.VideoMaxBytes, 10))
+	c.Header("Tus-Checksum-Algorithm", "md5,sha1,sha256")
+	c.Status(http.StatusNoContent)
+}
+
+// CreateUpload starts the upload of the video of a movie
+func (ctl *uploadsController) CreateUpload(c *gin.Context) {
+	if !ctl.checkTusVersion(c) {
+		return
+	}
+	movie := &movies.Movie{}
+	err := mgm.Coll(movie).FindByID(c.Param("id"), movie)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if !movie.CanEdit(currentUser) {
+		HTTPRes(c, http.StatusForbidden, "Insufficient permissions", "Current user is not allowed to edit this movie")
+		return
+	}
+
+	length, err := strconv.ParseInt(c.GetHeader("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid Upload-Length header")
+		return
+	}
+	if length > ctl.media.VideoMaxBytes {
+		HTTPRes(c, http.StatusRequestEntityTooLarge, "File upload error", "Video file is too large")
+		return
+	}
+	metadata, err := parseUploadMetadata(c.GetHeader("Upload-Metadata"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid Upload-Metadata header")
+		return
+	}
+	if fileType, ok := metadata["filetype"]; ok {
+		if _, ok := media.VideoExtensions[fileType]; !ok {
+			HTTPRes(c, http.StatusUnsupportedMediaType, "File upload error", media.ErrUnsupportedVideo.Error())
+			return
+		}
+	}
+
+	upload := &movies.VideoUpload{
+		MovieID:  movie.ID,
+		UserID:   currentUser.ID,
+		Length:   length,
+		Metadata: c.GetHeader("Upload-Metadata"),
+	}
+	if filename := metadata["filename"]; filename != "" {
+		upload.Filename = filepath.Base(filename)
+	}
+	if err := mgm.Coll(upload).Create(upload); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while creating upload", err.Error())
+		return
+	}
+	if err = os.MkdirAll(ctl.media.UploadsDir, 0755); err == nil {
+		var file *os.File
+		if file, err = os.Create(ctl.uploadPath(upload)); err == nil {
+			err = file.Close()
+		}
+	}
+	if err != nil {
+		_ = mgm.Coll(upload).Delete(upload)
+		HTTPRes(c, http.StatusInternalServerError, "Failed while creating upload", err.Error())
+		return
+	}
+
+	c.Header("Location", "/movie/video/uploads/"+upload.ID.Hex()+"/")
+	ctl.setExpires(c, upload)
+	c.Status(http.StatusCreated)
+}
+
+// GetUploadOffset tells how many bytes of the upload were received, so it can be resumed
+func (ctl *uploadsController) GetUploadOffset(c *gin.Context) {
+	if !ctl.checkTusVersion(c) {
+		return
+	}
+	upload, _, ok := ctl.findUpload(c)
+	if !ok {
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	c.Header("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if upload.Metadata != "" {
+		c.Header("Upload-Metadata", upload.Metadata)
+	}
+	ctl.setExpires(c, upload)
+	c.Header("Cache-Control", "no-store")
+	c.Status(http.StatusOK)
+}
+
+// PatchUpload appends a chunk to the upload. Without a checksum, the bytes received before
+// a connection failure are kept, so the client can resume from there.
+func (ctl *uploadsController) PatchUpload(c *gin.Context) {
+	if !ctl.checkTusVersion(c) {
+		return
+	}
+	if c.ContentType() != tusOffsetContentType {
+		HTTPRes(c, http.StatusUnsupportedMediaType, "File upload error", "Content-Type must be "+tusOffsetContentType)
+		return
+	}
+	offset, err := strconv.ParseInt(c.GetHeader("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid Upload-Offset header")
+		return
+	}
+	var hasher hash.Hash
+	var expectedSum []byte
+	if value := c.GetHeader("Upload-Checksum"); value != "" {
+		parts := strings.SplitN(value, " ", 2)
+		newHash, ok := tusChecksums[parts[0]]
+		if !ok || len(parts) != 2 {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Unsupported Upload-Checksum algorithm")
+			return
+		}
+		if expectedSum, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid Upload-Checksum header")
+			return
+		}
+		hasher = newHash()
+	}
+
+	upload, movie, ok := ctl.findUpload(c)
+	if !ok {
+		return
+	}
+	if !ctl.lock(upload) {
+		HTTPRes(c, http.StatusLocked, "Upload is locked", "Another request is writing to this upload")
+		return
+	}
+	defer ctl.unlock(upload)
+	if offset != upload.Offset {
+		HTTPRes(c, http.StatusConflict, "Conflict", "Upload-Offset does not match the upload offset")
+		return
+	}
+
+	file, err := os.OpenFile(ctl.uploadPath(upload), os.O_WRONLY, 0644)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while storing upload", err.Error())
+		return
+	}
+	// Bytes past the offset were written by a request that failed to record them
+	if err = file.Truncate(offset); err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		HTTPRes(c, http.StatusInternalServerError, "Failed while storing upload", err.Error())
+		return
+	}
+	var w io.Writer = file
+	if hasher != nil {
+		w = io.MultiWriter(file, hasher)
+	}
+	written, copyErr := io.Copy(w, io.LimitReader(c.Request.Body, upload.Length-offset))
+	if hasher != nil && (copyErr != nil || !bytes.Equal(hasher.Sum(nil), expectedSum)) {
+		// A chunk with a checksum is either stored whole or not at all
+		_ = file.Truncate(offset)
+		file.Close()
+		if copyErr != nil {
+			HTTPRes(c, http.StatusBadRequest, "File upload error", copyErr.Error())
+			return
+		}
+		HTTPRes(c, statusChecksumMismatch, "Checksum Mismatch", "Upload-Checksum does not match the received chunk")
+		return
+	}
+	if err = file.Close(); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while storing upload", err.Error())
+		return
+	}
+
+	upload.Offset = offset + written
+	if upload.ContentType == "" && (upload.Offset >= media.VideoSniffLength || upload.Offset == upload.Length) {
+		if upload.ContentType, err = ctl.sniffUpload(upload); err != nil {
+			ctl.terminate(upload)
+			HTTPRes(c, http.StatusUnsupportedMediaType, "File upload error", err.Error())
+			return
+		}
+	}
+	if err = ctl.mr.AdvanceUpload(upload, offset); err != nil {
+		if err == moviesrepo.ErrPreconditionFailed {
+			HTTPRes(c, http.StatusConflict, "Conflict", "Upload was modified by another request")
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while storing upload", err.Error())
+		return
+	}
+	c.Header("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	ctl.setExpires(c, upload)
+	if copyErr != nil {
+		HTTPRes(c, http.StatusBadRequest, "File upload error", copyErr.Error())
+		return
+	}
+
+	if upload.Offset == upload.Length {
+		if err = ctl.complete(c, upload, movie); err != nil {
+			HTTPRes(c, http.StatusInternalServerError, "Failed while storing video", err.Error())
+			return
+		}
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// DeleteUpload terminates an upload, discarding the bytes received
+func (ctl *uploadsController) DeleteUpload(c *gin.Context) {
+	if !ctl.checkTusVersion(c) {
+		return
+	}
+	upload, _, ok := ctl.findUpload(c)
+	if !ok {
+		return
+	}
+	if !ctl.lock(upload) {
+		HTTPRes(c, http.StatusLocked, "Upload is locked", "Another request is writing to this upload")
+		return
+	}
+	defer ctl.unlock(upload)
+	ctl.terminate(upload)
+	c.Status(http.StatusNoContent)
+}
+
+// findUpload loads the upload and its movie, checking the upload has not expired
+// and the current user may still edit the movie
+func (ctl *uploadsController) findUpload(c *gin.Context) (*movies.VideoUpload, *movies.Movie, bool) {
+	upload := &movies.VideoUpload{}
+	err := mgm.Coll(upload).FindByID(c.Param("upload"), upload)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Upload not found", nil)
+			return nil, nil, false
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting upload", err.Error())
+		return nil, nil, false
+	}
+	if time.Now().After(upload.ExpiresAt(ctl.media.UploadExpiry)) {
+		// The media GC deletes expired uploads, unless they are requested before
+		if ctl.lock(upload) {
+			ctl.terminate(upload)
+			ctl.unlock(upload)
+		}
+		HTTPRes(c, http.StatusGone, "Upload expired", nil)
+		return nil, nil, false
+	}
+	movie := &movies.Movie{}
+	err = mgm.Coll(movie).FindByID(upload.MovieID, movie)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			ctl.terminate(upload)
+			HTTPRes(c, http.StatusGone, "Movie was deleted", nil)
+			return nil, nil, false
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return nil, nil, false
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if !movie.CanEdit(currentUser) {
+		HTTPRes(c, http.StatusForbidden, "Insufficient permissions", "Current user is not allowed to edit this movie")
+		return nil, nil, false
+	}
+	return upload, movie, true
+}
+
+// complete moves the uploaded video to the storage and attaches it to the movie
+func (ctl *uploadsController) complete(c *gin.Context, upload *movies.VideoUpload, movie *movies.Movie) error {
+	file, err := os.Open(ctl.uploadPath(upload))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	ctx := c.Request.Context()
+	key := storage.VideosPrefix + movie.ID.Hex() + "-" + upload.ID.Hex() + media.VideoExtensions[upload.ContentType]
+	if err = ctl.store.Put(ctx, key, file, upload.Length, upload.ContentType); err != nil {
+		return err
+	}
+	previous := movie.Video
+	err = ctl.mr.SetVideo(movie, &movies.VideoInfo{
+		Key:         key,
+		ContentType: upload.ContentType,
+		Size:        upload.Length,
+		Filename:    upload.Filename,
+		UploadedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		// The stored file is left for the media GC, the upload can be completed again
+		return err
+	}
+	if previous != nil && previous.Key != key {
+		_ = ctl.store.Delete(ctx, previous.Key)
+	}
+	ctl.terminate(upload)
+	return nil
+}
+
+// sniffUpload detects the content type of the video from the first bytes received
+func (ctl *uploadsController) sniffUpload(upload *movies.VideoUpload) (string, error) {
+	file, err := os.Open(ctl.uploadPath(upload))
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	header := make([]byte, media.VideoSniffLength)
+	n, err := io.ReadFull(file, header)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return media.SniffVideo(header[:n])
+}
+
+// terminate discards the upload and the bytes received
+func (ctl *uploadsController) terminate(upload *movies.VideoUpload) {
+	_ = os.Remove(ctl.uploadPath(upload))
+	_ = ctl.mr.DeleteUpload(upload)
+}
+
+// setExpires tells the client when the upload expires if it receives no more bytes
+func (ctl *uploadsController) setExpires(c *gin.Context, upload *movies.VideoUpload) {
+	c.Header("Upload-Expires", upload.ExpiresAt(ctl.media.UploadExpiry).UTC().Format(http.TimeFormat))
+}
+
+func (ctl *uploadsController) uploadPath(upload *movies.VideoUpload) string {
+	return filepath.Join(ctl.media.UploadsDir, upload.ID.Hex())
+}
+
+// lock marks the upload as being written to, returning false if it already was
+func (ctl *uploadsController) lock(upload *movies.VideoUpload) bool {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	if ctl.busy[upload.ID.Hex()] {
+		return false
+	}
+	ctl.busy[upload.ID.Hex()] = true
+	return true
+}
+
+func (ctl *uploadsController) unlock(upload *movies.VideoUpload) {
+	ctl.mu.Lock()
+	defer ctl.mu.Unlock()
+	delete(ctl.busy, upload.ID.Hex())
+}
+
+// parseUploadMetadata decodes the Upload-Metadata header, a comma separated list
+// of keys each followed by a space and its base64 encoded value
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	if strings.TrimSpace(header) == "" {
+		return metadata, nil
+	}
+	for _, pair := range strings.Split(header, ",") {
+		parts := strings.SplitN(strings.TrimSpace(pair), " ", 2)
+		if parts[0] == "" {
+			return nil, errInvalidMetadata
+		}
+		value := ""
+		if len(parts) == 2 {
+			decoded, err := base64.StdEncoding.DecodeString(parts[1])
+			if err != nil {
+				return nil, errInvalidMetadata
+			}
+			value = string(decoded)
+		}
+		metadata[parts[0]] = value
+	}
+	return metadata, nil
+}
@@ -3,7 +3,9 @@ package controllers
 import (
 	"context"
 	"github.com/gin-gonic/gin"
+	"go-app/definitions/movies"
 	userdefinition "go-app/definitions/users"
+	"go-app/mediaurls"
 	"go-app/repositories/usersrepo"
 	"log"
 	"net/http"
@@ -13,15 +15,18 @@ import (
 type UserController interface {
 	RegisterUser(*gin.Context)
 	LoginUser(*gin.Context)
+	UpdatePreferences(*gin.Context)
+	RevokeMediaURLs(*gin.Context)
 }
 
 type userController struct {
-	br usersrepo.Repo
+	br     usersrepo.Repo
+	signer *mediaurls.Signer
 }
 
 // NewUserController instantiates User Controller
-func NewUserController(br usersrepo.Repo) UserController {
-	return &userController{br: br}
+func NewUserController(br usersrepo.Repo, signer *mediaurls.Signer) UserController {
+	return &userController{br: br, signer: signer}
 }
 
 func (ctl *userController) RegisterUser(c *gin.Context) {
@@ -52,12 +57,17 @@ func (ctl *userController) inputToUser(input userdefinition.UserInput) (*userdef
 	if err := conform.Struct(context.Background(), &input); err != nil {
 		return nil, err
 	}
+	lang, err := movies.ParseLanguage(input.Language)
+	if err != nil {
+		return nil, err
+	}
 
 	return &userdefinition.User{
 		FullName: input.FullName,
 		Age:      input.Age,
 		Email:    input.Email,
 		Password: input.Password,
+		Language: lang,
 	}, nil
 }
 
@@ -91,3 +101,42 @@ func (ctl *userController) LoginUser(c *gin.Context) {
 	HTTPRes(c, http.StatusOK, "User Authorized", tokenResponse)
 	return
 }
+
+// UpdatePreferences saves the preferences of the current user
+func (ctl *userController) UpdatePreferences(c *gin.Context) {
+	var preferencesInput userdefinition.PreferencesInput
+	if err := c.ShouldBindJSON(&preferencesInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+	if err := conform.Struct(context.Background(), &preferencesInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+	lang, err := movies.ParseLanguage(preferencesInput.Language)
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation error", err.Error())
+		return
+	}
+
+	currentUser := c.MustGet("user").(*userdefinition.User)
+	currentUser.Language = lang
+	if err := ctl.br.UpdatePreferences(currentUser); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while updating preferences", err.Error())
+		return
+	}
+
+	HTTPRes(c, http.StatusOK, "Preferences updated", preferencesInput)
+}
+
+// RevokeMediaURLs rotates the media salt of the current user, so the media URLs handed out so far stop working
+func (ctl *userController) RevokeMediaURLs(c *gin.Context) {
+	currentUser := c.MustGet("user").(*userdefinition.User)
+	if err := ctl.br.RotateMediaSalt(currentUser); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while revoking media URLs", err.Error())
+		return
+	}
+	ctl.signer.SetSalt(currentUser)
+
+	HTTPRes(c, http.StatusOK, "Media URLs revoked", nil)
+}
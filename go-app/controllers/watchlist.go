@@ -0,0 +1,130 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-app/definitions/movies"
+	"go-app/definitions/users"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"net/http"
+)
+
+// ListWatchlist lists the movies the current user saved to watch later, in the order of their watchlist
+func (ctl *moviesController) ListWatchlist(c *gin.Context) {
+	currentUser := c.MustGet("user").(*users.User)
+	entries, err := ctl.mr.ListWatchlist(currentUser.ID)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting watchlist", err.Error())
+		return
+	}
+	ids := make([]primitive.ObjectID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.MovieID
+	}
+	results, err := ctl.listMoviesByID(c, currentUser, ids)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting movie info", err.Error())
+		return
+	}
+	c.Header("Vary", "Accept-Language")
+	HTTPRes(c, http.StatusOK, "Watchlist", results)
+}
+
+// AddToWatchlist adds a movie at the end of the watchlist of the current user
+func (ctl *moviesController) AddToWatchlist(c *gin.Context) {
+	movie, ok := ctl.findMovie(c)
+	if !ok {
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if !movie.CanView(currentUser) {
+		HTTPRes(c, http.StatusNotFound, "Movie not found", nil)
+		return
+	}
+	if err := ctl.mr.AddToWatchlist(movie.ID, currentUser.ID); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while adding movie to watchlist", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "Movie added to watchlist", nil)
+}
+
+// RemoveFromWatchlist removes a movie from the watchlist of the current user
+func (ctl *moviesController) RemoveFromWatchlist(c *gin.Context) {
+	movieID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Invalid movie ID")
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	if err = ctl.mr.RemoveFromWatchlist(movieID, currentUser.ID); err != nil {
+		if err == mongo.ErrNoDocuments {
+			HTTPRes(c, http.StatusNotFound, "Movie not in watchlist", nil)
+			return
+		}
+		HTTPRes(c, http.StatusInternalServerError, "Failed while removing movie from watchlist", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "Movie removed from watchlist", nil)
+}
+
+// ReorderWatchlist orders the watchlist of the current user, given every movie of it in the new order
+func (ctl *moviesController) ReorderWatchlist(c *gin.Context) {
+	var reorderInput movies.ReorderWatchlistInput
+	if err := c.ShouldBindJSON(&reorderInput); err != nil {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", err.Error())
+		return
+	}
+	currentUser := c.MustGet("user").(*users.User)
+	entries, err := ctl.mr.ListWatchlist(currentUser.ID)
+	if err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Error getting watchlist", err.Error())
+		return
+	}
+
+	inList := map[primitive.ObjectID]bool{}
+	for _, entry := range entries {
+		inList[entry.MovieID] = true
+	}
+	ordered := make([]primitive.ObjectID, 0, len(reorderInput.MovieIDs))
+	for _, hex := range reorderInput.MovieIDs {
+		movieID, err := primitive.ObjectIDFromHex(hex)
+		if err != nil || !inList[movieID] {
+			HTTPRes(c, http.StatusBadRequest, "Validation Error", "Movie "+hex+" is not in the watchlist")
+			return
+		}
+		// Listed movies are removed from inList, so duplicates are caught as well
+		delete(inList, movieID)
+		ordered = append(ordered, movieID)
+	}
+	if len(inList) > 0 {
+		HTTPRes(c, http.StatusBadRequest, "Validation Error", "Every movie of the watchlist must be listed")
+		return
+	}
+
+	if err = ctl.mr.ReorderWatchlist(currentUser.ID, ordered); err != nil {
+		HTTPRes(c, http.StatusInternalServerError, "Failed while reordering watchlist", err.Error())
+		return
+	}
+	HTTPRes(c, http.StatusOK, "Watchlist reordered", nil)
+}
+
+// withWatchlistFlags tells signed in users which of the listed movies are in their watchlist
+func (ctl *moviesController) withWatchlistFlags(c *gin.Context, results []movies.MovieInfo) error {
+	currentUser := optionalUser(c)
+	if currentUser == nil || len(results) == 0 {
+		return nil
+	}
+	ids := make([]primitive.ObjectID, len(results))
+	for i := range results {
+		ids[i] = results[i].ID
+	}
+	inList, err := ctl.mr.InWatchlist(currentUser.ID, ids)
+	if err != nil {
+		return err
+	}
+	for i := range results {
+		flag := inList[results[i].ID]
+		results[i].InMyList = &flag
+	}
+	return nil
+}
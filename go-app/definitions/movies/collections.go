@@ -0,0 +1,85 @@
+package movies
+
+import (
+	"github.com/kamva/mgm/v3"
+	"go-app/definitions/users"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+// Collection visibilities
+const (
+	// VisibilityPrivate collections are only visible to their owner
+	VisibilityPrivate = "private"
+	// VisibilityUnlisted collections are visible to anyone with their share link
+	VisibilityUnlisted = "unlisted"
+	// VisibilityPublic collections are listed and visible to everyone
+	VisibilityPublic = "public"
+)
+
+// MovieCollection is a named list of movies curated by a user
+type MovieCollection struct {
+	mgm.DefaultModel `bson:",inline"`
+	OwnerID          primitive.ObjectID   `bson:"owner_id"`
+	Name             string               `bson:"name"`
+	Description      string               `bson:"description"`
+	Visibility       string               `bson:"visibility"`
+	MovieIDs         []primitive.ObjectID `bson:"movie_ids"`
+	// ShareToken is the secret part of the share link of the collection
+	ShareToken string `bson:"share_token"`
+	// CopiedFrom is the collection this one was copied from
+	CopiedFrom *primitive.ObjectID `bson:"copied_from,omitempty"`
+}
+
+func (m *MovieCollection) CollectionName() string {
+	return "movie_collections"
+}
+
+// CanView checks if the user, nil when anonymous, may see the collection without its share link
+func (m *MovieCollection) CanView(user *users.User) bool {
+	return m.Visibility == VisibilityPublic || (user != nil && user.ID == m.OwnerID)
+}
+
+// ShareURL returns the link unlisted and public collections are shared with
+func (m *MovieCollection) ShareURL() string {
+	if m.Visibility == VisibilityPrivate {
+		return ""
+	}
+	return "/collections/shared/" + m.ShareToken + "/"
+}
+
+// CollectionInput represents createCollection and updateCollection body format,
+// movie_ids being the movies of the collection in their order
+type CollectionInput struct {
+	Name        string   `json:"name" mod:"trim" binding:"required,max=100"`
+	Description string   `json:"description" mod:"trim" binding:"max=2000"`
+	Visibility  string   `json:"visibility" binding:"omitempty,oneof=private unlisted public"`
+	MovieIDs    []string `json:"movie_ids" binding:"max=500"`
+}
+
+// CollectionOutput is a collection along with the movies the current user can see in it
+type CollectionOutput struct {
+	ID          primitive.ObjectID  `json:"id"`
+	OwnerID     primitive.ObjectID  `json:"owner_id"`
+	Name        string              `json:"name"`
+	Description string              `json:"description"`
+	Visibility  string              `json:"visibility"`
+	ShareURL    string              `json:"share_url,omitempty"`
+	CopiedFrom  *primitive.ObjectID `json:"copied_from,omitempty"`
+	Movies      []MovieInfo         `json:"movies"`
+	CreatedAt   time.Time           `json:"created_at"`
+	UpdatedAt   time.Time           `json:"updated_at"`
+}
+
+// CollectionSummary is a collection in listings, counting the movies the current user can see in it
+type CollectionSummary struct {
+	ID          primitive.ObjectID   `bson:"_id" json:"id"`
+	OwnerID     primitive.ObjectID   `bson:"owner_id" json:"owner_id"`
+	OwnerName   string               `bson:"owner_name" json:"owner_name"`
+	Name        string               `bson:"name" json:"name"`
+	Description string               `bson:"description" json:"description"`
+	Visibility  string               `bson:"visibility" json:"visibility"`
+	MovieIDs    []primitive.ObjectID `bson:"movie_ids" json:"-"`
+	MoviesCount int                  `bson:"-" json:"movies_count"`
+	UpdatedAt   time.Time            `bson:"updated_at" json:"updated_at"`
+}
@@ -1,40 +1,214 @@
 package movies
 
 import (
+	"errors"
 	"github.com/kamva/mgm/v3"
+	"go-app/definitions/users"
 	"go.mongodb.org/mongo-driver/bson/primitive"
+	"golang.org/x/text/language"
 	"mime/multipart"
+	"strconv"
 	"time"
 )
 
 // Movie struct
 type Movie struct {
 	mgm.DefaultModel `bson:",inline"`
-	Name             string             `bson:"name,omitempty"`
-	Description      string             `bson:"description,omitempty"`
-	Date             time.Time          `bson:"date,omitempty"` // TODO: use string to parse date from it
-	AddedBy          primitive.ObjectID `bson:"added_by,omitempty"`
+	Name             string               `bson:"name,omitempty"`
+	Description      string               `bson:"description,omitempty"`
+	Date             ReleaseDate          `bson:",inline"`
+	OriginalLanguage string               `bson:"original_language,omitempty"`
+	AddedBy          primitive.ObjectID   `bson:"added_by,omitempty"`
+	ExternalID       string               `bson:"external_id,omitempty"`
+	Translations     []MovieTranslation   `bson:"translations,omitempty"`
+	NormalizedName   string               `bson:"normalized_name,omitempty"`
+	Editors          []primitive.ObjectID `bson:"editors,omitempty"`
+	Status           string               `bson:"status,omitempty"`
+	RejectionReason  string               `bson:"rejection_reason,omitempty"`
+	Cover            *CoverInfo           `bson:"cover,omitempty"`
+	Video            *VideoInfo           `bson:"video,omitempty"`
+	Subtitles        []SubtitleTrack      `bson:"subtitles,omitempty"`
+}
+
+// CoverInfo describes the cover image of a movie
+type CoverInfo struct {
+	Key              string           `bson:"key" json:"-"`
+	ContentType      string           `bson:"content_type" json:"content_type"`
+	Width            int              `bson:"width" json:"width"`
+	Height           int              `bson:"height" json:"height"`
+	Size             int64            `bson:"size" json:"size"`
+	Version          string           `bson:"version,omitempty" json:"version,omitempty"`
+	Renditions       []CoverRendition `bson:"renditions,omitempty" json:"renditions,omitempty"`
+	CoverPlaceholder `bson:",inline"`
+}
+
+// CoverPlaceholder is what clients render while the cover loads
+type CoverPlaceholder struct {
+	BlurHash      string  `bson:"blurhash,omitempty" json:"blurhash,omitempty"`
+	DominantColor string  `bson:"dominant_color,omitempty" json:"dominant_color,omitempty"`
+	AspectRatio   float64 `bson:"aspect_ratio,omitempty" json:"aspect_ratio,omitempty"`
+}
+
+// Placeholder returns the placeholder of the cover, or nil if there is no cover
+// or it was uploaded before placeholders were computed
+func (cover *CoverInfo) Placeholder() *CoverPlaceholder {
+	if cover == nil || cover.BlurHash == "" {
+		return nil
+	}
+	placeholder := cover.CoverPlaceholder
+	return &placeholder
+}
+
+// CoverRendition is a resized and re-encoded copy of a cover
+type CoverRendition struct {
+	Size   string `bson:"size" json:"size"`
+	Format string `bson:"format" json:"format"`
+	Key    string `bson:"key" json:"-"`
+	Width  int    `bson:"width" json:"width"`
+	Height int    `bson:"height" json:"height"`
+	Bytes  int64  `bson:"bytes" json:"bytes"`
+}
+
+// Rendition returns the cover rendition of the given size and format, or nil if there is none
+func (cover *CoverInfo) Rendition(size string, format string) *CoverRendition {
+	for i := range cover.Renditions {
+		if cover.Renditions[i].Size == size && cover.Renditions[i].Format == format {
+			return &cover.Renditions[i]
+		}
+	}
+	return nil
+}
+
+// CoverURLs links to the cover renditions of a movie. The URLs carry the cover version,
+// so they change when a new cover is uploaded and can be cached for good.
+type CoverURLs struct {
+	Thumb    string `json:"thumb"`
+	Medium   string `json:"medium"`
+	Original string `json:"original"`
+}
+
+// NewCoverURLs returns the cover URLs of a movie, or nil if it has no cover
+func NewCoverURLs(movieID primitive.ObjectID, cover *CoverInfo) *CoverURLs {
+	if cover == nil {
+		return nil
+	}
+	url := func(size string) string {
+		url := "/movie/cover/" + movieID.Hex() + "/?size=" + size
+		if cover.Version != "" {
+			url += "&v=" + cover.Version
+		}
+		return url
+	}
+	return &CoverURLs{
+		Thumb:    url("thumb"),
+		Medium:   url("medium"),
+		Original: url("original"),
+	}
+}
+
+// Movie statuses, movies added before statuses existed have none and are published
+const (
+	StatusDraft         = "draft"
+	StatusPendingReview = "pending_review"
+	StatusPublished     = "published"
+	StatusRejected      = "rejected"
+)
+
+// IsPublished checks if the movie is visible to everyone
+func (model *Movie) IsPublished() bool {
+	return model.Status == "" || model.Status == StatusPublished
+}
+
+// CanView checks if the user, nil when anonymous, may see the movie: published movies are public,
+// others are only visible to their owner, editors and moderators
+func (model *Movie) CanView(user *users.User) bool {
+	if model.IsPublished() {
+		return true
+	}
+	return user != nil && (model.CanEdit(user) || user.HasRole(users.RoleModerator))
+}
+
+// CanManage checks if the user may delete the movie and manage who edits it,
+// which only its owner and admins can do
+func (model *Movie) CanManage(user *users.User) bool {
+	return model.AddedBy == user.ID || user.HasRole(users.RoleAdmin)
+}
+
+// CanEdit checks if the user owns the movie or was granted editor rights on it
+func (model *Movie) CanEdit(user *users.User) bool {
+	if model.CanManage(user) {
+		return true
+	}
+	for _, editor := range model.Editors {
+		if editor == user.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// Saving keeps the normalized name used for duplicate detection in sync with the name
+func (model *Movie) Saving() error {
+	model.NormalizedName = NormalizeTitle(model.Name)
+	return model.DefaultModel.Saving()
+}
+
+// MovieTranslation holds the localized name and description of a movie
+type MovieTranslation struct {
+	Lang        string `bson:"lang" json:"lang"`
+	Name        string `bson:"name" json:"name"`
+	Description string `bson:"description,omitempty" json:"description,omitempty"`
+}
+
+// ParseLanguage canonicalizes an optional language tag, such as the language of a movie or a user preference
+func ParseLanguage(value string) (string, error) {
+	if value == "" {
+		return "", nil
+	}
+	tag, err := language.Parse(value)
+	if err != nil {
+		return "", errors.New("invalid language tag")
+	}
+	return tag.String(), nil
+}
+
+// TranslationInput represents the localized name and description of a movie
+type TranslationInput struct {
+	Name        string `json:"name" mod:"trim" binding:"required"`
+	Description string `json:"description" mod:"trim"`
+}
+
+// ETag returns the entity tag of a movie version, derived from its last update time.
+// Mongo stores dates with millisecond precision, so the tag is computed in milliseconds.
+func ETag(updatedAt time.Time) string {
+	return `"` + strconv.FormatInt(updatedAt.UnixNano()/int64(time.Millisecond), 36) + `"`
 }
 
 type AddMovieInput struct {
-	Name        string    `json:"name" mod:"trim,title" binding:"required"`
-	Description string    `json:"description" mod:"trim" binding:"required"`
-	Date        time.Time `json:"date"` // TODO: use string to parse date from it
+	Name             string      `json:"name" mod:"trim,title" binding:"required"`
+	Description      string      `json:"description" mod:"trim" binding:"required"`
+	Date             ReleaseDate `json:"date"`
+	OriginalLanguage string      `json:"original_language,omitempty" mod:"trim"`
 }
 type AddMovieOutput struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Date        time.Time `json:"date"` // TODO: use string to parse date to it
+	ID               string      `json:"id"`
+	Name             string      `json:"name"`
+	Description      string      `json:"description"`
+	Date             ReleaseDate `json:"date"`
+	OriginalLanguage string      `json:"original_language,omitempty"`
+	Status           string      `json:"status"`
+	RejectionReason  string      `json:"rejection_reason,omitempty"`
+	CoverURLs        *CoverURLs  `json:"cover_urls,omitempty"`
 }
 type UploadCoverInput struct {
 	Cover *multipart.FileHeader `form:"cover" binding:"required"`
 }
 
 type UpdateMovieInput struct {
-	Name        string    `json:"name" mod:"trim,title"`
-	Description string    `json:"description" mod:"trim"`
-	Date        time.Time `json:"date"`
+	Name             string      `json:"name" mod:"trim,title"`
+	Description      string      `json:"description" mod:"trim"`
+	Date             ReleaseDate `json:"date"`
+	OriginalLanguage string      `json:"original_language" mod:"trim"`
 }
 
 type WatchedMovieEntry struct {
@@ -47,6 +221,15 @@ func (m *WatchedMovieEntry) CollectionName() string {
 	return "watched"
 }
 
+// WatchedMovieInfo is a movie of the watched list of a user
+type WatchedMovieInfo struct {
+	WatchedAt      time.Time `bson:"updated_at" json:"watched_at"`
+	FirstWatchedAt time.Time `bson:"created_at" json:"first_watched_at"`
+	// MyRating is the rating the user gave the movie, nil if they did not review it
+	MyRating *uint8    `bson:"my_rating,omitempty" json:"my_rating"`
+	Movie    MovieInfo `bson:"movie" json:"movie"`
+}
+
 type ReviewMovieInput struct {
 	Rating uint8  `json:"rating" binding:"required,gte=1,lte=5"`
 	Review string `json:"review" mod:"trim"`
@@ -66,8 +249,160 @@ func (m *ReviewMovieEntry) CollectionName() string {
 
 type MovieInfo struct {
 	mgm.DefaultModel `bson:",inline"`
-	Name             string    `bson:"name,omitempty"`
-	Description      string    `bson:"description,omitempty"`
-	Date             time.Time `bson:"date,omitempty"` // TODO: use string to parse date from it
-	Rating           float32   `bson:"rating,omitempty"`
+	Name             string             `bson:"name,omitempty"`
+	Description      string             `bson:"description,omitempty"`
+	Date             ReleaseDate        `bson:",inline"`
+	OriginalLanguage string             `bson:"original_language,omitempty"`
+	Rating           float32            `bson:"rating,omitempty"`
+	ReviewsCount     int                `bson:"reviews_count"`
+	Translations     []MovieTranslation `bson:"translations,omitempty" json:"-"`
+	Status           string             `bson:"status,omitempty"`
+	RejectionReason  string             `bson:"rejection_reason,omitempty"`
+	Cover            *CoverInfo         `bson:"cover,omitempty" json:"-"`
+	CoverURLs        *CoverURLs         `bson:"-"`
+	CoverPlaceholder *CoverPlaceholder  `bson:"-"`
+	Subtitles        []SubtitleTrack    `bson:"subtitles,omitempty"`
+	Video            *VideoInfo         `bson:"video,omitempty" json:"-"`
+	StreamURLs       *StreamURLs        `bson:"-"`
+	// Progress is the playback progress of the current user
+	Progress *ProgressOutput `bson:"-"`
+	// InMyList tells signed in users whether the movie is in their watchlist
+	InMyList *bool `bson:"-" json:",omitempty"`
+	// Language is the language tag of the localized Name and Description, empty for the original
+	Language string `bson:"-"`
+}
+
+// IsPublished checks if the movie is visible to everyone
+func (model *MovieInfo) IsPublished() bool {
+	return model.Status == "" || model.Status == StatusPublished
+}
+
+// MovieExport is a row of the catalog export
+type MovieExport struct {
+	ID           primitive.ObjectID `bson:"_id" json:"id"`
+	ExternalID   string             `bson:"external_id,omitempty" json:"external_id,omitempty"`
+	Name         string             `bson:"name" json:"name"`
+	Description  string             `bson:"description" json:"description"`
+	Date         ReleaseDate        `bson:",inline" json:"date"`
+	Rating       float32            `bson:"rating" json:"rating"`
+	ReviewsCount int                `bson:"reviews_count" json:"reviews_count"`
+	CreatedAt    time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt    time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// MovieRevision records a single change made to a movie
+type MovieRevision struct {
+	mgm.DefaultModel `bson:",inline"`
+	MovieID          primitive.ObjectID `bson:"movie_id" json:"movie_id"`
+	Rev              int                `bson:"rev" json:"rev"`
+	ChangedBy        primitive.ObjectID `bson:"changed_by" json:"changed_by"`
+	Changes          []FieldChange      `bson:"changes" json:"changes"`
+	RevertOf         int                `bson:"revert_of,omitempty" json:"revert_of,omitempty"`
+}
+
+func (m *MovieRevision) CollectionName() string {
+	return "movie_revisions"
+}
+
+// FieldChange holds the old and new values of a changed movie field
+type FieldChange struct {
+	Field string      `bson:"field" json:"field"`
+	Old   interface{} `bson:"old" json:"old"`
+	New   interface{} `bson:"new" json:"new"`
+}
+
+// MovieRevisionInfo is a revision along with the user who made it
+type MovieRevisionInfo struct {
+	MovieRevision  `bson:",inline"`
+	ChangedByName  string `bson:"changed_by_name" json:"changed_by_name"`
+	ChangedByEmail string `bson:"changed_by_email" json:"changed_by_email"`
+}
+
+// CollaboratorInput represents the user a movie is shared with or transferred to
+type CollaboratorInput struct {
+	Email string `json:"email" mod:"trim,lcase" binding:"required"`
+}
+
+// Collaborator roles on a movie
+const (
+	CollaboratorOwner  = "owner"
+	CollaboratorEditor = "editor"
+)
+
+// Collaborator is a user allowed to edit a movie
+type Collaborator struct {
+	ID       primitive.ObjectID `json:"id"`
+	FullName string             `json:"full_name"`
+	Email    string             `json:"email"`
+	Role     string             `json:"role"`
+}
+
+// RejectMovieInput represents rejectMovie body format
+type RejectMovieInput struct {
+	Reason string `json:"reason" mod:"trim" binding:"required"`
+}
+
+// DuplicateCandidate is an existing movie that looks like the one being added
+type DuplicateCandidate struct {
+	ID         primitive.ObjectID `json:"id"`
+	Name       string             `json:"name"`
+	Date       ReleaseDate        `json:"date"`
+	Similarity float64            `json:"similarity"`
+}
+
+// MergeMoviesInput represents mergeMovies body format
+type MergeMoviesInput struct {
+	SurvivorID   string   `json:"survivor_id" binding:"required"`
+	DuplicateIDs []string `json:"duplicate_ids" binding:"required,min=1"`
+}
+
+// MergeResult counts what was moved onto the surviving movie
+type MergeResult struct {
+	Merged         int `json:"merged"`
+	ReviewsMoved   int `json:"reviews_moved"`
+	WatchedMoved   int `json:"watched_moved"`
+	ProgressMoved  int `json:"progress_moved"`
+	WatchlistMoved int `json:"watchlist_moved"`
+	EntriesDropped int `json:"entries_dropped"`
+}
+
+// ImportMovieInput represents a single row of a bulk import
+type ImportMovieInput struct {
+	ExternalID string `json:"external_id" mod:"trim" binding:"required"`
+	AddMovieInput
+}
+
+// Import job statuses
+const (
+	ImportPending   = "pending"
+	ImportRunning   = "running"
+	ImportCompleted = "completed"
+	ImportFailed    = "failed"
+)
+
+// ImportJob tracks the progress and outcome of a bulk import
+type ImportJob struct {
+	mgm.DefaultModel `bson:",inline"`
+	Format           string             `bson:"format" json:"format"`
+	DryRun           bool               `bson:"dry_run" json:"dry_run"`
+	Status           string             `bson:"status" json:"status"`
+	StartedBy        primitive.ObjectID `bson:"started_by" json:"started_by"`
+	Total            int                `bson:"total" json:"total"`
+	Created          int                `bson:"created" json:"created"`
+	Updated          int                `bson:"updated" json:"updated"`
+	Failed           int                `bson:"failed" json:"failed"`
+	RowErrors        []ImportRowError   `bson:"row_errors" json:"row_errors"`
+	Error            string             `bson:"error,omitempty" json:"error,omitempty"`
+	FinishedAt       *time.Time         `bson:"finished_at,omitempty" json:"finished_at,omitempty"`
+}
+
+func (m *ImportJob) CollectionName() string {
+	return "import_jobs"
+}
+
+// ImportRowError describes why a row of an import was rejected
+type ImportRowError struct {
+	Row        int    `bson:"row" json:"row"`
+	ExternalID string `bson:"external_id,omitempty" json:"external_id,omitempty"`
+	Error      string `bson:"error" json:"error"`
 }
@@ -0,0 +1,72 @@
+package movies
+
+import (
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"math"
+)
+
+// PlaybackProgress is how far a user got playing a movie, reported by players as it plays
+type PlaybackProgress struct {
+	mgm.DefaultModel `bson:",inline"`
+	MovieID          primitive.ObjectID `bson:"movie_id" json:"movie_id"`
+	UserID           primitive.ObjectID `bson:"user_id" json:"-"`
+	// Position and Duration are in seconds
+	Position float64 `bson:"position" json:"position"`
+	Duration float64 `bson:"duration" json:"duration"`
+	Percent  float64 `bson:"percent" json:"percent"`
+	// Completed is set once the position passes the watched threshold
+	Completed bool `bson:"completed" json:"completed"`
+	// Dismissed hides the movie from the "continue watching" row until playback is reported again
+	Dismissed bool `bson:"dismissed,omitempty" json:"-"`
+}
+
+func (m *PlaybackProgress) CollectionName() string {
+	return "playback_progress"
+}
+
+// ResumePosition returns where playback resumes: the last position, or the start once completed
+func (m *PlaybackProgress) ResumePosition() float64 {
+	if m.Completed {
+		return 0
+	}
+	return m.Position
+}
+
+// Report records a position reported by a player, completing the movie past the threshold percentage
+func (m *PlaybackProgress) Report(input *ProgressInput, threshold float64) {
+	m.Duration = input.Duration
+	m.Position = math.Min(input.Position, input.Duration)
+	m.Percent = math.Round(m.Position/m.Duration*1000) / 10
+	m.Completed = m.Percent >= threshold
+	m.Dismissed = false
+}
+
+// ProgressInput represents reportProgress body format
+type ProgressInput struct {
+	Position float64 `json:"position" binding:"gte=0"`
+	Duration float64 `json:"duration" binding:"required,gt=0"`
+}
+
+// ProgressOutput is the progress of the current user on a movie
+type ProgressOutput struct {
+	Position       float64 `json:"position"`
+	Duration       float64 `json:"duration"`
+	Percent        float64 `json:"percent"`
+	Completed      bool    `json:"completed"`
+	ResumePosition float64 `json:"resume_position"`
+}
+
+// NewProgressOutput returns the output of the progress, or nil without progress
+func NewProgressOutput(progress *PlaybackProgress) *ProgressOutput {
+	if progress == nil {
+		return nil
+	}
+	return &ProgressOutput{
+		Position:       progress.Position,
+		Duration:       progress.Duration,
+		Percent:        progress.Percent,
+		Completed:      progress.Completed,
+		ResumePosition: progress.ResumePosition(),
+	}
+}
@@ -0,0 +1,103 @@
+package movies
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Release date precisions
+const (
+	PrecisionYear  = "year"
+	PrecisionMonth = "month"
+	PrecisionDay   = "day"
+)
+
+// releaseDateLayouts maps each precision to the layout it is parsed from and rendered with
+var releaseDateLayouts = map[string]string{
+	PrecisionYear:  "2006",
+	PrecisionMonth: "2006-01",
+	PrecisionDay:   "2006-01-02",
+}
+
+// ReleaseDate is a release date known to the year, month or day, i.e. "1999", "1999-03" or "1999-03-31".
+// Time is the start of the period and End the start of the next one, so movies of mixed
+// precisions can be sorted and filtered by the periods they cover.
+type ReleaseDate struct {
+	Time      time.Time `bson:"date,omitempty"`
+	Precision string    `bson:"date_precision,omitempty"`
+	End       time.Time `bson:"date_end,omitempty"`
+}
+
+// ParseReleaseDate parses a release date of any precision.
+// Full timestamps are accepted as well and kept to the day.
+func ParseReleaseDate(value string) (ReleaseDate, error) {
+	for _, precision := range []string{PrecisionYear, PrecisionMonth, PrecisionDay} {
+		if t, err := time.Parse(releaseDateLayouts[precision], value); err == nil {
+			return NewReleaseDate(t, precision), nil
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return NewReleaseDate(t, PrecisionDay), nil
+	}
+	return ReleaseDate{}, fmt.Errorf("invalid release date %q, expected YYYY, YYYY-MM or YYYY-MM-DD", value)
+}
+
+// NewReleaseDate truncates t to the given precision
+func NewReleaseDate(t time.Time, precision string) ReleaseDate {
+	year, month, day := t.Date()
+	start := time.Date(year, month, day, 0, 0, 0, 0, time.UTC)
+	switch precision {
+	case PrecisionYear:
+		start = time.Date(year, time.January, 1, 0, 0, 0, 0, time.UTC)
+		return ReleaseDate{Time: start, Precision: precision, End: start.AddDate(1, 0, 0)}
+	case PrecisionMonth:
+		start = time.Date(year, month, 1, 0, 0, 0, 0, time.UTC)
+		return ReleaseDate{Time: start, Precision: precision, End: start.AddDate(0, 1, 0)}
+	}
+	return ReleaseDate{Time: start, Precision: PrecisionDay, End: start.AddDate(0, 0, 1)}
+}
+
+// IsZero checks if the release date is unknown
+func (d ReleaseDate) IsZero() bool {
+	return d.Time.IsZero()
+}
+
+// String renders the release date in its own precision.
+// Dates stored before precisions existed are rendered to the day.
+func (d ReleaseDate) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	layout, ok := releaseDateLayouts[d.Precision]
+	if !ok {
+		layout = releaseDateLayouts[PrecisionDay]
+	}
+	return d.Time.UTC().Format(layout)
+}
+
+// MarshalJSON renders the release date as a string, or null if it is unknown
+func (d ReleaseDate) MarshalJSON() ([]byte, error) {
+	if d.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON parses the release date from a string, leaving it unknown for null or ""
+func (d *ReleaseDate) UnmarshalJSON(data []byte) error {
+	var value *string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+	if value == nil || *value == "" {
+		*d = ReleaseDate{}
+		return nil
+	}
+	parsed, err := ParseReleaseDate(*value)
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
+}
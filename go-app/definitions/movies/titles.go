@@ -0,0 +1,82 @@
+package movies
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// leadingArticles are dropped from the start of titles before comparing them
+var leadingArticles = []string{"the ", "a ", "an "}
+
+// NormalizeTitle reduces a title to a form suitable for duplicate detection:
+// lower case, without accents, punctuation or a leading article, and with single spaces
+func NormalizeTitle(title string) string {
+	stripAccents := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(stripAccents, title)
+	if err != nil {
+		stripped = title
+	}
+
+	var b strings.Builder
+	for _, r := range strings.ToLower(stripped) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		case unicode.IsSpace(r) || unicode.IsPunct(r) || unicode.IsSymbol(r):
+			b.WriteRune(' ')
+		}
+	}
+	normalized := strings.Join(strings.Fields(b.String()), " ")
+
+	for _, article := range leadingArticles {
+		if strings.HasPrefix(normalized, article) {
+			return strings.TrimPrefix(normalized, article)
+		}
+	}
+	return normalized
+}
+
+// TitleSimilarity compares two normalized titles, from 0 (nothing in common) to 1 (identical),
+// based on their Levenshtein distance
+func TitleSimilarity(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	longest := len(ra)
+	if len(rb) > longest {
+		longest = len(rb)
+	}
+	if longest == 0 {
+		return 1
+	}
+
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min3(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return 1 - float64(previous[len(rb)])/float64(longest)
+}
+
+func min3(a, b, c int) int {
+	if b < a {
+		a = b
+	}
+	if c < a {
+		a = c
+	}
+	return a
+}
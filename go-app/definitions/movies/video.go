@@ -0,0 +1,134 @@
+package movies
+
+import (
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"mime/multipart"
+	"strconv"
+	"time"
+)
+
+// VideoInfo describes the video file of a movie
+type VideoInfo struct {
+	Key         string    `bson:"key" json:"-"`
+	ContentType string    `bson:"content_type" json:"content_type"`
+	Size        int64     `bson:"size" json:"size"`
+	Filename    string    `bson:"filename,omitempty" json:"filename,omitempty"`
+	UploadedAt  time.Time `bson:"uploaded_at" json:"uploaded_at"`
+}
+
+// VideoUpload tracks a resumable upload of the video of a movie. The bytes received so far
+// are kept in a local file until the upload completes and the video is moved to the storage.
+type VideoUpload struct {
+	mgm.DefaultModel `bson:",inline"`
+	MovieID          primitive.ObjectID `bson:"movie_id"`
+	UserID           primitive.ObjectID `bson:"user_id"`
+	Length           int64              `bson:"length"`
+	Offset           int64              `bson:"offset"`
+	// Metadata is the Upload-Metadata header as sent on creation, returned as is on HEAD requests
+	Metadata string `bson:"metadata,omitempty"`
+	Filename string `bson:"filename,omitempty"`
+	// ContentType is sniffed once enough bytes were received, empty until then
+	ContentType string `bson:"content_type,omitempty"`
+}
+
+func (m *VideoUpload) CollectionName() string {
+	return "video_uploads"
+}
+
+// ExpiresAt returns when the upload expires, unless it receives more bytes
+func (m *VideoUpload) ExpiresAt(expiry time.Duration) time.Time {
+	return m.UpdatedAt.Add(expiry)
+}
+
+// Rendition containers, MPEG-TS segments can only be played with HLS,
+// fragmented MP4 segments with both HLS and DASH
+const (
+	ContainerTS   = "ts"
+	ContainerFMP4 = "fmp4"
+)
+
+// InitSegmentName is the name of the initialization segment of fragmented MP4 renditions
+const InitSegmentName = "init.mp4"
+
+// VideoRendition is an encoding of the video of a movie at a given bitrate, split in segments
+type VideoRendition struct {
+	mgm.DefaultModel `bson:",inline"`
+	MovieID          primitive.ObjectID `bson:"movie_id" json:"movie_id"`
+	Name             string             `bson:"name" json:"name"`
+	Bandwidth        int                `bson:"bandwidth" json:"bandwidth"`
+	Width            int                `bson:"width" json:"width"`
+	Height           int                `bson:"height" json:"height"`
+	Codecs           string             `bson:"codecs,omitempty" json:"codecs,omitempty"`
+	Container        string             `bson:"container" json:"container"`
+	InitKey          string             `bson:"init_key,omitempty" json:"-"`
+	// Segments maps segment indexes to segments, so segments can be uploaded in any order
+	Segments map[string]VideoSegment `bson:"segments,omitempty" json:"-"`
+}
+
+func (m *VideoRendition) CollectionName() string {
+	return "video_renditions"
+}
+
+// VideoSegment is a few seconds long part of a rendition
+type VideoSegment struct {
+	Key      string  `bson:"key"`
+	Duration float64 `bson:"duration"`
+	Size     int64   `bson:"size"`
+}
+
+// SegmentName returns the name of the media segment at index
+func (m *VideoRendition) SegmentName(index int) string {
+	if m.Container == ContainerFMP4 {
+		return strconv.Itoa(index) + ".m4s"
+	}
+	return strconv.Itoa(index) + ".ts"
+}
+
+// PlayableSegments returns the segments from the first one up to the first missing one,
+// or none if the initialization segment of a fragmented MP4 rendition is missing
+func (m *VideoRendition) PlayableSegments() []VideoSegment {
+	segments := []VideoSegment{}
+	if m.Container == ContainerFMP4 && m.InitKey == "" {
+		return segments
+	}
+	for i := 0; ; i++ {
+		segment, ok := m.Segments[strconv.Itoa(i)]
+		if !ok {
+			return segments
+		}
+		segments = append(segments, segment)
+	}
+}
+
+// RenditionInput represents saveRendition body format
+type RenditionInput struct {
+	Bandwidth int    `json:"bandwidth" binding:"required,gt=0"`
+	Width     int    `json:"width" binding:"required,gt=0"`
+	Height    int    `json:"height" binding:"required,gt=0"`
+	Codecs    string `json:"codecs" mod:"trim"`
+	Container string `json:"container" binding:"required,oneof=ts fmp4"`
+}
+
+// SubtitleTrack is a WebVTT subtitle file of a movie in a language
+type SubtitleTrack struct {
+	Lang       string    `bson:"lang" json:"lang"`
+	Key        string    `bson:"key" json:"-"`
+	Cues       int       `bson:"cues" json:"cues"`
+	UploadedAt time.Time `bson:"uploaded_at" json:"uploaded_at"`
+	URL        string    `bson:"-" json:"url,omitempty"`
+}
+
+// UploadSubtitlesInput represents uploadSubtitles form format
+type UploadSubtitlesInput struct {
+	File *multipart.FileHeader `form:"file" binding:"required"`
+}
+
+// StreamURLs links to the video of a movie: the video itself, and the HLS playlist and DASH manifest
+// of its renditions. They are signed for the user they are handed out to, so players can use them
+// without a token, and expire.
+type StreamURLs struct {
+	Video string `json:"video,omitempty"`
+	HLS   string `json:"hls,omitempty"`
+	DASH  string `json:"dash,omitempty"`
+}
@@ -0,0 +1,24 @@
+package movies
+
+import (
+	"github.com/kamva/mgm/v3"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// WatchlistEntry is a movie a user saved to watch later
+type WatchlistEntry struct {
+	mgm.DefaultModel `bson:",inline"`
+	MovieID          primitive.ObjectID `bson:"movie_id"`
+	UserID           primitive.ObjectID `bson:"user_id"`
+	// Position orders the watchlist of the user
+	Position int `bson:"position"`
+}
+
+func (m *WatchlistEntry) CollectionName() string {
+	return "watchlist"
+}
+
+// ReorderWatchlistInput represents reorderWatchlist body format, every movie of the watchlist in the new order
+type ReorderWatchlistInput struct {
+	MovieIDs []string `json:"movie_ids" binding:"required"`
+}
@@ -17,6 +17,29 @@ type User struct {
 	Age              uint8  `bson:"age"`
 	Email            string `bson:"email"`
 	Password         string `bson:"password"`
+	Language         string `bson:"language,omitempty"`
+	Role             string `bson:"role,omitempty"`
+	// MediaSalt is mixed in the signatures of the user's media URLs, rotating it revokes them
+	MediaSalt string `bson:"media_salt,omitempty" json:"-"`
+}
+
+// User roles, regular users have none
+const (
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// HasRole checks if the user has one of the roles; admins have every role
+func (model *User) HasRole(roles ...string) bool {
+	if model.Role == RoleAdmin {
+		return true
+	}
+	for _, role := range roles {
+		if model.Role == role {
+			return true
+		}
+	}
+	return false
 }
 
 func (model *User) Saving() error {
@@ -55,6 +78,12 @@ type UserInput struct {
 	Email                string `json:"email" mod:"trim,lcase" binding:"required"`
 	Password             string `json:"password" binding:"required,eqfield=PasswordConfirmation"`
 	PasswordConfirmation string `json:"password_confirmation" binding:"required"`
+	Language             string `json:"language" mod:"trim"`
+}
+
+// PreferencesInput represents updatePreferences body format
+type PreferencesInput struct {
+	Language string `json:"language" mod:"trim"`
 }
 
 // LoginInfoInput represents
@@ -3,16 +3,21 @@ module go-app
 go 1.14
 
 require (
+	github.com/buckket/go-blurhash v1.1.0
+	github.com/chai2010/webp v1.1.0
 	github.com/dgrijalva/jwt-go v3.2.0+incompatible
+	github.com/evanphx/json-patch v4.12.0+incompatible
 	github.com/gin-gonic/gin v1.7.0
 	github.com/go-playground/mold/v4 v4.2.0
 	github.com/golang/protobuf v1.4.2 // indirect
 	github.com/joho/godotenv v1.3.0
-	github.com/kamva/mgm/v3 v3.4.1 // indirect
+	github.com/kamva/mgm/v3 v3.4.1
+	github.com/minio/minio-go/v7 v7.0.12
 	github.com/modern-go/concurrent v0.0.0-20180306012644-bacd9c7ef1dd // indirect
 	github.com/modern-go/reflect2 v1.0.1 // indirect
 	go.mongodb.org/mongo-driver v1.8.1
 	golang.org/x/crypto v0.0.0-20201216223049-8b5274cf687f
+	golang.org/x/image v0.0.0-20211028202545-6944b10bf410
 	golang.org/x/sync v0.0.0-20200317015054-43a5402ce75a // indirect
-	golang.org/x/sys v0.0.0-20200513112337-417ce2331b5c // indirect
+	golang.org/x/text v0.3.6
 )
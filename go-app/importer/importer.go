@@ -0,0 +1,185 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/mold/v4/modifiers"
+	"github.com/kamva/mgm/v3"
+	"go-app/definitions/movies"
+	"go-app/definitions/users"
+	"go-app/repositories/moviesrepo"
+	"go.mongodb.org/mongo-driver/mongo"
+	"io"
+	"time"
+)
+
+const (
+	// progressEvery is how many rows are processed between job progress updates
+	progressEvery = 100
+	// maxRowErrors caps the number of row errors stored in a job report
+	maxRowErrors = 1000
+)
+
+var conform = modifiers.New()
+
+// Importer imports movies in bulk, upserting them by their external key
+type Importer struct {
+	mr moviesrepo.Repo
+}
+
+// NewImporter instantiates the Importer
+func NewImporter(mr moviesrepo.Repo) *Importer {
+	return &Importer{mr: mr}
+}
+
+// CreateJob registers a pending import job started by the owner
+func (im *Importer) CreateJob(format string, dryRun bool, owner *users.User) (*movies.ImportJob, error) {
+	job := &movies.ImportJob{
+		Format:    format,
+		DryRun:    dryRun,
+		Status:    movies.ImportPending,
+		StartedBy: owner.ID,
+		RowErrors: []movies.ImportRowError{},
+	}
+	if err := mgm.Coll(job).Create(job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// Run imports every row read from r on behalf of the owner, recording the outcome in the job.
+// Rows failing validation are reported in the job and do not stop the import.
+func (im *Importer) Run(job *movies.ImportJob, r io.Reader, owner *users.User) error {
+	job.Status = movies.ImportRunning
+	if err := mgm.Coll(job).Update(job); err != nil {
+		return err
+	}
+
+	err := im.importRows(job, r, owner)
+
+	finishedAt := time.Now().UTC()
+	job.FinishedAt = &finishedAt
+	job.Status = movies.ImportCompleted
+	if err != nil {
+		job.Status = movies.ImportFailed
+		job.Error = err.Error()
+	}
+	if updateErr := mgm.Coll(job).Update(job); updateErr != nil {
+		return updateErr
+	}
+	return err
+}
+
+func (im *Importer) importRows(job *movies.ImportJob, r io.Reader, owner *users.User) error {
+	reader, err := newRowReader(job.Format, r)
+	if err != nil {
+		return err
+	}
+
+	// A dry run writes nothing, so the rows it already saw stand for the movies they would have created
+	seen := map[string]bool{}
+	for {
+		row, input, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			if _, ok := err.(*rowError); !ok {
+				return err
+			}
+		}
+
+		job.Total++
+		created := false
+		if err == nil {
+			created, err = im.importRow(input, owner, job.DryRun)
+			if err == nil && job.DryRun {
+				created = created && !seen[input.ExternalID]
+				seen[input.ExternalID] = true
+			}
+		}
+		switch {
+		case err != nil:
+			job.Failed++
+			if len(job.RowErrors) < maxRowErrors {
+				rowErr := movies.ImportRowError{Row: row, Error: err.Error()}
+				if input != nil {
+					rowErr.ExternalID = input.ExternalID
+				}
+				job.RowErrors = append(job.RowErrors, rowErr)
+			}
+		case created:
+			job.Created++
+		default:
+			job.Updated++
+		}
+
+		if job.Total%progressEvery == 0 {
+			if err := mgm.Coll(job).Update(job); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// importRow validates the row with the same rules as AddMovie, then creates the movie
+// or updates the one with the same external key. Nothing is written on a dry run.
+func (im *Importer) importRow(input *movies.ImportMovieInput, owner *users.User, dryRun bool) (created bool, err error) {
+	if err := binding.Validator.ValidateStruct(input); err != nil {
+		return false, err
+	}
+	if err := conform.Struct(context.Background(), input); err != nil {
+		return false, err
+	}
+
+	if input.OriginalLanguage, err = movies.ParseLanguage(input.OriginalLanguage); err != nil {
+		return false, err
+	}
+
+	existing, err := im.mr.FindByExternalID(input.ExternalID)
+	if err != nil {
+		return false, err
+	}
+
+	if existing == nil {
+		if dryRun {
+			return true, nil
+		}
+		movie := &movies.Movie{
+			Name:             input.Name,
+			Description:      input.Description,
+			Date:             input.Date,
+			AddedBy:          owner.ID,
+			ExternalID:       input.ExternalID,
+			Status:           movies.StatusDraft,
+			OriginalLanguage: input.OriginalLanguage,
+		}
+		err = mgm.Coll(movie).Create(movie)
+		if !mongo.IsDuplicateKeyError(err) {
+			return true, err
+		}
+		// A concurrent import created the movie since it was looked up, it is updated instead
+		existing, err = im.mr.FindByExternalID(input.ExternalID)
+		if err != nil {
+			return false, err
+		}
+		if existing == nil {
+			return false, errors.New("movie with external key " + input.ExternalID + " was deleted while importing it")
+		}
+	}
+
+	if !existing.CanEdit(owner) {
+		return false, errors.New("current user is not allowed to edit this movie")
+	}
+	if dryRun {
+		return false, nil
+	}
+
+	before := *existing
+	existing.Name = input.Name
+	existing.Description = input.Description
+	existing.Date = input.Date
+	existing.OriginalLanguage = input.OriginalLanguage
+	return false, im.mr.SaveMovieWithRevision(&before, existing, owner)
+}
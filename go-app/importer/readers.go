@@ -0,0 +1,176 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-app/definitions/movies"
+	"io"
+	"strings"
+)
+
+// Formats supported by the importer
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// ValidFormat checks if the importer can read the given format
+func ValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatJSON || format == FormatNDJSON
+}
+
+// rowError is returned by a rowReader when only the current row is malformed
+type rowError struct {
+	err error
+}
+
+func (e *rowError) Error() string {
+	return e.err.Error()
+}
+
+// rowReader yields import rows one at a time, returning io.EOF when done
+type rowReader interface {
+	Next() (row int, input *movies.ImportMovieInput, err error)
+}
+
+func newRowReader(format string, r io.Reader) (rowReader, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVReader(r)
+	case FormatJSON:
+		return newJSONReader(r)
+	case FormatNDJSON:
+		return newNDJSONReader(r), nil
+	}
+	return nil, fmt.Errorf("unsupported import format %q", format)
+}
+
+// csvReader reads rows from a CSV file with a header line naming the columns
+type csvReader struct {
+	r       *csv.Reader
+	columns []string
+	row     int
+}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err != nil {
+		if err == io.EOF {
+			return nil, errors.New("missing CSV header")
+		}
+		return nil, err
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	return &csvReader{r: reader, columns: header}, nil
+}
+
+// Next converts the record to JSON so that CSV rows are decoded with the same rules as JSON rows
+func (cr *csvReader) Next() (int, *movies.ImportMovieInput, error) {
+	record, err := cr.r.Read()
+	if err == io.EOF {
+		return 0, nil, io.EOF
+	}
+	cr.row++
+	if err != nil {
+		if _, ok := err.(*csv.ParseError); ok {
+			return cr.row, nil, &rowError{err}
+		}
+		return cr.row, nil, err
+	}
+	if len(record) > len(cr.columns) {
+		return cr.row, nil, &rowError{errors.New("row has more fields than the header")}
+	}
+
+	fields := map[string]string{}
+	for i, value := range record {
+		if value != "" {
+			fields[cr.columns[i]] = value
+		}
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return cr.row, nil, &rowError{err}
+	}
+	input := &movies.ImportMovieInput{}
+	if err := json.Unmarshal(encoded, input); err != nil {
+		return cr.row, nil, &rowError{err}
+	}
+	return cr.row, input, nil
+}
+
+// jsonReader streams the elements of a JSON array
+type jsonReader struct {
+	d   *json.Decoder
+	row int
+}
+
+func newJSONReader(r io.Reader) (*jsonReader, error) {
+	decoder := json.NewDecoder(r)
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+	if delim, ok := token.(json.Delim); !ok || delim != '[' {
+		return nil, errors.New("JSON import must be an array of movies")
+	}
+	return &jsonReader{d: decoder}, nil
+}
+
+func (jr *jsonReader) Next() (int, *movies.ImportMovieInput, error) {
+	if !jr.d.More() {
+		if _, err := jr.d.Token(); err != nil {
+			return 0, nil, err
+		}
+		return 0, nil, io.EOF
+	}
+	jr.row++
+	input := &movies.ImportMovieInput{}
+	if err := jr.d.Decode(input); err != nil {
+		// Type errors leave the decoder at the next element, syntax errors do not
+		if _, ok := err.(*json.UnmarshalTypeError); ok {
+			return jr.row, nil, &rowError{err}
+		}
+		return jr.row, nil, err
+	}
+	return jr.row, input, nil
+}
+
+// ndjsonReader reads one JSON movie per line, skipping blank lines
+type ndjsonReader struct {
+	s   *bufio.Scanner
+	row int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &ndjsonReader{s: scanner}
+}
+
+func (nr *ndjsonReader) Next() (int, *movies.ImportMovieInput, error) {
+	for nr.s.Scan() {
+		nr.row++
+		line := strings.TrimSpace(nr.s.Text())
+		if line == "" {
+			continue
+		}
+		input := &movies.ImportMovieInput{}
+		if err := json.Unmarshal([]byte(line), input); err != nil {
+			return nr.row, nil, &rowError{err}
+		}
+		return nr.row, input, nil
+	}
+	if err := nr.s.Err(); err != nil {
+		return nr.row, nil, err
+	}
+	return 0, nil, io.EOF
+}
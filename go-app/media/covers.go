@@ -0,0 +1,110 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	// Register the decoders of the supported cover formats
+	_ "image/jpeg"
+	_ "image/png"
+
+	_ "golang.org/x/image/webp"
+)
+
+// Supported cover content types
+const (
+	JPEG = "image/jpeg"
+	PNG  = "image/png"
+	WebP = "image/webp"
+)
+
+// coverFormats maps supported content types to the names of their image decoders
+var coverFormats = map[string]string{
+	JPEG: "jpeg",
+	PNG:  "png",
+	WebP: "webp",
+}
+
+// Extensions maps supported content types to file extensions
+var Extensions = map[string]string{
+	JPEG: ".jpg",
+	PNG:  ".png",
+	WebP: ".webp",
+}
+
+var (
+	// ErrCoverTooLarge is returned for covers over the byte size limit
+	ErrCoverTooLarge = errors.New("cover file is too large")
+	// ErrUnsupportedCover is returned for covers that are not JPEG, PNG or WebP images
+	ErrUnsupportedCover = errors.New("cover must be a JPEG, PNG or WebP image")
+)
+
+// CoverLimits bounds the size of uploaded covers
+type CoverLimits struct {
+	MaxBytes  int64
+	MinWidth  int
+	MinHeight int
+	MaxWidth  int
+	MaxHeight int
+}
+
+// Cover is a validated cover image, stripped of its metadata
+type Cover struct {
+	Data        []byte
+	ContentType string
+	Width       int
+	Height      int
+	Image       image.Image
+}
+
+// ProcessCover reads and validates an uploaded cover. The content type is sniffed from the data,
+// and the dimensions are checked from the image header before the image is decoded,
+// so images that would decompress to huge bitmaps are rejected early.
+func ProcessCover(r io.Reader, limits CoverLimits) (*Cover, error) {
+	data, err := ioutil.ReadAll(io.LimitReader(r, limits.MaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limits.MaxBytes {
+		return nil, ErrCoverTooLarge
+	}
+
+	contentType := http.DetectContentType(data)
+	format, ok := coverFormats[contentType]
+	if !ok {
+		return nil, ErrUnsupportedCover
+	}
+
+	config, decodedFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || decodedFormat != format {
+		return nil, ErrUnsupportedCover
+	}
+	if config.Width < limits.MinWidth || config.Height < limits.MinHeight ||
+		config.Width > limits.MaxWidth || config.Height > limits.MaxHeight {
+		return nil, fmt.Errorf("cover must be between %dx%d and %dx%d pixels, got %dx%d",
+			limits.MinWidth, limits.MinHeight, limits.MaxWidth, limits.MaxHeight, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("cover image is corrupted: %v", err)
+	}
+
+	stripped, err := StripMetadata(data, contentType)
+	if err != nil {
+		return nil, fmt.Errorf("cover image is corrupted: %v", err)
+	}
+
+	return &Cover{
+		Data:        stripped,
+		ContentType: contentType,
+		Width:       config.Width,
+		Height:      config.Height,
+		Image:       img,
+	}, nil
+}
@@ -0,0 +1,76 @@
+package media
+
+import (
+	"fmt"
+	"image"
+	"math"
+
+	"github.com/buckket/go-blurhash"
+)
+
+// placeholderBounds is the box covers are scaled down to before computing their placeholder,
+// the placeholder being blurry there is no point in looking at more pixels
+var placeholderBounds = image.Point{X: 32, Y: 48}
+
+// BlurHash components along the width and the height, covers being portraits
+const (
+	blurHashXComponents = 3
+	blurHashYComponents = 4
+)
+
+// Placeholder is what clients render while a cover loads
+type Placeholder struct {
+	BlurHash      string
+	DominantColor string
+	AspectRatio   float64
+}
+
+// CoverPlaceholder computes the BlurHash, dominant color and aspect ratio of a cover
+func CoverPlaceholder(cover *Cover) (*Placeholder, error) {
+	small := fit(cover.Image, placeholderBounds)
+	hash, err := blurhash.Encode(blurHashXComponents, blurHashYComponents, small)
+	if err != nil {
+		return nil, err
+	}
+	return &Placeholder{
+		BlurHash:      hash,
+		DominantColor: dominantColor(small),
+		AspectRatio:   math.Round(float64(cover.Width)/float64(cover.Height)*10000) / 10000,
+	}, nil
+}
+
+// dominantColor returns the average color of the most common color bucket of the image, as #rrggbb
+func dominantColor(img image.Image) string {
+	type bucket struct {
+		count   int
+		r, g, b uint32
+	}
+	buckets := map[uint32]*bucket{}
+	var dominant *bucket
+	bounds := img.Bounds()
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			r, g, b, _ := img.At(x, y).RGBA()
+			r, g, b = r>>8, g>>8, b>>8
+			// Colors are bucketed on their 4 most significant bits per channel
+			key := (r>>4)<<8 | (g>>4)<<4 | b>>4
+			current, ok := buckets[key]
+			if !ok {
+				current = &bucket{}
+				buckets[key] = current
+			}
+			current.count++
+			current.r += r
+			current.g += g
+			current.b += b
+			if dominant == nil || current.count > dominant.count {
+				dominant = current
+			}
+		}
+	}
+	if dominant == nil {
+		return "#000000"
+	}
+	n := uint32(dominant.count)
+	return fmt.Sprintf("#%02x%02x%02x", dominant.r/n, dominant.g/n, dominant.b/n)
+}
@@ -0,0 +1,123 @@
+package media
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/color"
+	"image/jpeg"
+
+	"github.com/chai2010/webp"
+	"golang.org/x/image/draw"
+)
+
+// Cover rendition sizes
+const (
+	SizeThumb    = "thumb"
+	SizeMedium   = "medium"
+	SizeOriginal = "original"
+)
+
+// Cover rendition formats
+const (
+	FormatJPEG = "jpeg"
+	FormatWebP = "webp"
+)
+
+// FormatTypes maps rendition formats to their content types
+var FormatTypes = map[string]string{
+	FormatJPEG: JPEG,
+	FormatWebP: WebP,
+}
+
+// Sizes lists the rendition sizes, Formats the rendition formats
+var (
+	Sizes   = []string{SizeThumb, SizeMedium, SizeOriginal}
+	Formats = []string{FormatJPEG, FormatWebP}
+)
+
+// sizeBounds is the box resized renditions are fitted in, keeping their aspect ratio
+var sizeBounds = map[string]image.Point{
+	SizeThumb:  {X: 160, Y: 240},
+	SizeMedium: {X: 480, Y: 720},
+}
+
+const (
+	jpegQuality = 85
+	webpQuality = 80
+)
+
+// Rendition is a cover encoded at one of the rendition sizes and formats
+type Rendition struct {
+	Size   string
+	Format string
+	Data   []byte
+	Width  int
+	Height int
+}
+
+// Version identifies the content of a cover, it changes whenever a different image is uploaded
+func (cover *Cover) Version() string {
+	sum := sha256.Sum256(cover.Data)
+	return hex.EncodeToString(sum[:8])
+}
+
+// RenderCover generates every size and format of the cover. Images are never upscaled,
+// and the original rendition in the uploaded format is the uploaded cover itself.
+func RenderCover(cover *Cover) ([]Rendition, error) {
+	renditions := make([]Rendition, 0, len(Sizes)*len(Formats))
+	for _, size := range Sizes {
+		img := fit(cover.Image, sizeBounds[size])
+		bounds := img.Bounds()
+		for _, format := range Formats {
+			rendition := Rendition{Size: size, Format: format, Width: bounds.Dx(), Height: bounds.Dy()}
+			if size == SizeOriginal && FormatTypes[format] == cover.ContentType {
+				rendition.Data = cover.Data
+			} else {
+				data, err := encode(img, format)
+				if err != nil {
+					return nil, err
+				}
+				rendition.Data = data
+			}
+			renditions = append(renditions, rendition)
+		}
+	}
+	return renditions, nil
+}
+
+// fit scales the image down to fit in bounds, and flattens it on a white background
+// as neither JPEG nor the lossy WebP renditions keep transparency
+func fit(src image.Image, bounds image.Point) image.Image {
+	width, height := src.Bounds().Dx(), src.Bounds().Dy()
+	if bounds.X > 0 && (width > bounds.X || height > bounds.Y) {
+		if width*bounds.Y > height*bounds.X {
+			width, height = bounds.X, maxInt(1, height*bounds.X/width)
+		} else {
+			width, height = maxInt(1, width*bounds.Y/height), bounds.Y
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Over, nil)
+	return dst
+}
+
+func encode(img image.Image, format string) ([]byte, error) {
+	if format == FormatWebP {
+		return webp.EncodeRGB(img, webpQuality)
+	}
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,198 @@
+package media
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// WebVTTContentType is the content type subtitles are served with
+const WebVTTContentType = "text/vtt; charset=utf-8"
+
+// SubtitlesMaxBytes bounds the size of uploaded subtitle files
+const SubtitlesMaxBytes = 2 << 20
+
+// ErrInvalidSubtitles is returned for files that are neither SRT nor WebVTT
+var ErrInvalidSubtitles = errors.New("subtitles must be an UTF-8 SRT or WebVTT file")
+
+// Cue is a subtitle text shown between Start and End
+type Cue struct {
+	Start time.Duration
+	End   time.Duration
+	// Settings are the WebVTT cue settings, such as the position of the text
+	Settings string
+	Text     string
+}
+
+var (
+	// timestampPattern matches SRT (00:00:01,000) and WebVTT (00:00:01.000 or 00:01.000) timestamps
+	timestampPattern = regexp.MustCompile(`^(?:(\d+):)?(\d{2}):(\d{2})[.,](\d{3})$`)
+	// srtTagsPattern matches SRT formatting WebVTT does not support
+	srtTagsPattern = regexp.MustCompile(`(?i)</?font[^>]*>|\{\\[^}]*\}`)
+)
+
+// ParseSubtitles parses an SRT or WebVTT file, recognized from its header
+func ParseSubtitles(data []byte) ([]Cue, error) {
+	data = bytes.TrimPrefix(data, []byte("\xef\xbb\xbf"))
+	if !utf8.Valid(data) {
+		return nil, ErrInvalidSubtitles
+	}
+	text := strings.Replace(strings.Replace(string(data), "\r\n", "\n", -1), "\r", "\n", -1)
+	blocks := splitBlocks(text)
+	if len(blocks) == 0 {
+		return nil, ErrInvalidSubtitles
+	}
+
+	webVTT := blocks[0][0] == "WEBVTT" || strings.HasPrefix(blocks[0][0], "WEBVTT ") ||
+		strings.HasPrefix(blocks[0][0], "WEBVTT\t")
+	if webVTT {
+		// The first block is the file header
+		blocks = blocks[1:]
+	}
+
+	cues := []Cue{}
+	for i, block := range blocks {
+		if webVTT && (block[0] == "NOTE" || strings.HasPrefix(block[0], "NOTE ") ||
+			block[0] == "STYLE" || block[0] == "REGION") {
+			continue
+		}
+		// Cues may start with an identifier, the index of the cue in SRT files
+		if !strings.Contains(block[0], "-->") {
+			block = block[1:]
+		}
+		if len(block) == 0 {
+			return nil, fmt.Errorf("subtitle block %d has no timing", i+1)
+		}
+		cue, err := parseTiming(block[0], webVTT)
+		if err != nil {
+			return nil, fmt.Errorf("subtitle block %d: %v", i+1, err)
+		}
+		lines := block[1:]
+		if !webVTT {
+			for j := range lines {
+				lines[j] = srtTagsPattern.ReplaceAllString(lines[j], "")
+			}
+		}
+		cue.Text = strings.TrimSpace(strings.Join(lines, "\n"))
+		if cue.Text == "" {
+			continue
+		}
+		// WebVTT cue text can't contain the timing arrow
+		cue.Text = strings.Replace(cue.Text, "-->", "->", -1)
+		cues = append(cues, cue)
+	}
+	if len(cues) == 0 {
+		return nil, ErrInvalidSubtitles
+	}
+	return cues, nil
+}
+
+// splitBlocks splits the text in blocks of non empty lines
+func splitBlocks(text string) [][]string {
+	blocks := [][]string{}
+	current := []string{}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				blocks = append(blocks, current)
+				current = []string{}
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		blocks = append(blocks, current)
+	}
+	return blocks
+}
+
+// parseTiming parses a cue timing line, i.e. 00:00:01,000 --> 00:00:04,000
+func parseTiming(line string, webVTT bool) (Cue, error) {
+	parts := strings.SplitN(line, "-->", 2)
+	if len(parts) != 2 {
+		return Cue{}, errors.New("invalid cue timing")
+	}
+	start, err := parseTimestamp(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return Cue{}, err
+	}
+	fields := strings.Fields(parts[1])
+	if len(fields) == 0 {
+		return Cue{}, errors.New("invalid cue timing")
+	}
+	end, err := parseTimestamp(fields[0])
+	if err != nil {
+		return Cue{}, err
+	}
+	if end <= start {
+		return Cue{}, errors.New("cue ends before it starts")
+	}
+	cue := Cue{Start: start, End: end}
+	// SRT coordinates have no WebVTT equivalent, only WebVTT settings are kept
+	if webVTT {
+		cue.Settings = strings.Join(fields[1:], " ")
+	}
+	return cue, nil
+}
+
+func parseTimestamp(value string) (time.Duration, error) {
+	match := timestampPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	hours := 0
+	if match[1] != "" {
+		hours, _ = strconv.Atoi(match[1])
+	}
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.Atoi(match[3])
+	millis, _ := strconv.Atoi(match[4])
+	if minutes > 59 || seconds > 59 {
+		return 0, fmt.Errorf("invalid timestamp %q", value)
+	}
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second + time.Duration(millis)*time.Millisecond, nil
+}
+
+// ShiftCues moves the cues by offset, to resync subtitles with the video.
+// Cues moved before the start of the video are dropped, or cut if they overlap it.
+func ShiftCues(cues []Cue, offset time.Duration) []Cue {
+	shifted := make([]Cue, 0, len(cues))
+	for _, cue := range cues {
+		cue.Start += offset
+		cue.End += offset
+		if cue.End <= 0 {
+			continue
+		}
+		if cue.Start < 0 {
+			cue.Start = 0
+		}
+		shifted = append(shifted, cue)
+	}
+	return shifted
+}
+
+// WriteWebVTT writes the cues as a WebVTT file
+func WriteWebVTT(cues []Cue) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("WEBVTT\n")
+	for _, cue := range cues {
+		buf.WriteString("\n" + formatTimestamp(cue.Start) + " --> " + formatTimestamp(cue.End))
+		if cue.Settings != "" {
+			buf.WriteString(" " + cue.Settings)
+		}
+		buf.WriteString("\n" + cue.Text + "\n")
+	}
+	return buf.Bytes()
+}
+
+func formatTimestamp(d time.Duration) string {
+	millis := d / time.Millisecond
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", millis/3600000, millis/60000%60, millis/1000%60, millis%1000)
+}
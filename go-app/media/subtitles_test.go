@@ -0,0 +1,216 @@
+package media
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// at returns the duration of a h:m:s.ms timestamp
+func at(hours, minutes, seconds, millis int) time.Duration {
+	return time.Duration(hours)*time.Hour + time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second + time.Duration(millis)*time.Millisecond
+}
+
+func TestParseSubtitles(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want []Cue
+	}{
+		{
+			"srt",
+			"1\n00:00:01,000 --> 00:00:04,000\nHello\nworld\n\n2\n00:00:05,500 --> 00:00:06,000\nBye\n",
+			[]Cue{
+				{Start: at(0, 0, 1, 0), End: at(0, 0, 4, 0), Text: "Hello\nworld"},
+				{Start: at(0, 0, 5, 500), End: at(0, 0, 6, 0), Text: "Bye"},
+			},
+		},
+		{
+			"srt with BOM and CRLF",
+			"\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nBye\r\n",
+			[]Cue{
+				{Start: at(0, 0, 1, 0), End: at(0, 0, 2, 0), Text: "Hello"},
+				{Start: at(0, 0, 3, 0), End: at(0, 0, 4, 0), Text: "Bye"},
+			},
+		},
+		{
+			"srt with CR line endings",
+			"1\r00:00:01,000 --> 00:00:02,000\rHello\r",
+			[]Cue{{Start: at(0, 0, 1, 0), End: at(0, 0, 2, 0), Text: "Hello"}},
+		},
+		{
+			"srt without index lines",
+			"00:00:01,000 --> 00:00:02,000\nHello\n",
+			[]Cue{{Start: at(0, 0, 1, 0), End: at(0, 0, 2, 0), Text: "Hello"}},
+		},
+		{
+			"srt coordinates and tags dropped",
+			"1\n00:00:01,000 --> 00:00:02,000 X1:10 X2:20\n<font color=\"red\">{\\an8}Hello</font> <i>you</i>\n",
+			[]Cue{{Start: at(0, 0, 1, 0), End: at(0, 0, 2, 0), Text: "Hello <i>you</i>"}},
+		},
+		{
+			"srt cues without text skipped",
+			"1\n00:00:01,000 --> 00:00:02,000\n<font></font>\n\n2\n00:00:03,000 --> 00:00:04,000\nBye\n",
+			[]Cue{{Start: at(0, 0, 3, 0), End: at(0, 0, 4, 0), Text: "Bye"}},
+		},
+		{
+			"webvtt",
+			"WEBVTT - A movie\n\nintro\n01:02:03.004 --> 01:02:05.000 align:start line:0\nHello\n\n00:10.000 --> 00:11.000\nShort timestamps\n",
+			[]Cue{
+				{Start: at(1, 2, 3, 4), End: at(1, 2, 5, 0), Settings: "align:start line:0", Text: "Hello"},
+				{Start: at(0, 0, 10, 0), End: at(0, 0, 11, 0), Text: "Short timestamps"},
+			},
+		},
+		{
+			"webvtt NOTE, STYLE and REGION blocks",
+			"WEBVTT\n\nNOTE\nA comment\n\nNOTE another comment\n\nSTYLE\n::cue { color: red }\n\nREGION\nid:top\n\n00:00:01.000 --> 00:00:02.000\nHello\n",
+			[]Cue{{Start: at(0, 0, 1, 0), End: at(0, 0, 2, 0), Text: "Hello"}},
+		},
+		{
+			"webvtt with BOM and CRLF",
+			"\xef\xbb\xbfWEBVTT\r\n\r\n00:00:01.000 --> 00:00:02.000\r\nHello\r\n",
+			[]Cue{{Start: at(0, 0, 1, 0), End: at(0, 0, 2, 0), Text: "Hello"}},
+		},
+		{
+			"timing arrow escaped in text",
+			"WEBVTT\n\n00:00:01.000 --> 00:00:02.000\nA --> B\n",
+			[]Cue{{Start: at(0, 0, 1, 0), End: at(0, 0, 2, 0), Text: "A -> B"}},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParseSubtitles([]byte(test.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestParseSubtitlesErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+	}{
+		{"empty", ""},
+		{"blank", "\xef\xbb\xbf\r\n\r\n"},
+		{"not utf-8", "1\n00:00:01,000 --> 00:00:02,000\n\xff\xfe\n"},
+		{"header only", "WEBVTT\n"},
+		{"comments only", "WEBVTT\n\nNOTE nothing to show\n"},
+		{"missing timing", "1\nHello\n"},
+		{"index without timing", "1\n\n00:00:01,000 --> 00:00:02,000\nHello\n"},
+		{"invalid timestamp", "1\n00:00:01 --> 00:00:02,000\nHello\n"},
+		{"out of range minutes", "1\n00:60:01,000 --> 00:61:02,000\nHello\n"},
+		{"ends before start", "1\n00:00:02,000 --> 00:00:01,000\nHello\n"},
+		{"ends at start", "1\n00:00:02,000 --> 00:00:02,000\nHello\n"},
+		{"missing end", "1\n00:00:02,000 -->\nHello\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if cues, err := ParseSubtitles([]byte(test.data)); err == nil {
+				t.Fatalf("got %+v, want an error", cues)
+			}
+		})
+	}
+}
+
+func TestShiftCues(t *testing.T) {
+	cues := []Cue{
+		{Start: at(0, 0, 1, 0), End: at(0, 0, 2, 0), Text: "first"},
+		{Start: at(0, 0, 3, 0), End: at(0, 0, 5, 0), Text: "second"},
+	}
+	tests := []struct {
+		name   string
+		offset time.Duration
+		want   []Cue
+	}{
+		{"none", 0, cues},
+		{
+			"later",
+			1500 * time.Millisecond,
+			[]Cue{
+				{Start: at(0, 0, 2, 500), End: at(0, 0, 3, 500), Text: "first"},
+				{Start: at(0, 0, 4, 500), End: at(0, 0, 6, 500), Text: "second"},
+			},
+		},
+		{
+			"earlier",
+			-500 * time.Millisecond,
+			[]Cue{
+				{Start: at(0, 0, 0, 500), End: at(0, 0, 1, 500), Text: "first"},
+				{Start: at(0, 0, 2, 500), End: at(0, 0, 4, 500), Text: "second"},
+			},
+		},
+		{
+			"earlier than the first cue, which is dropped",
+			-2 * time.Second,
+			[]Cue{{Start: at(0, 0, 1, 0), End: at(0, 0, 3, 0), Text: "second"}},
+		},
+		{
+			"overlapping the start of the video, the cue is cut",
+			-4 * time.Second,
+			[]Cue{{Start: 0, End: at(0, 0, 1, 0), Text: "second"}},
+		},
+		{"earlier than every cue", -5 * time.Second, []Cue{}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ShiftCues(cues, test.offset)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Fatalf("got %+v, want %+v", got, test.want)
+			}
+		})
+	}
+	if cues[0].Start != at(0, 0, 1, 0) {
+		t.Fatal("shifting changed the original cues")
+	}
+}
+
+func TestWriteWebVTT(t *testing.T) {
+	tests := []struct {
+		name string
+		cues []Cue
+		want string
+	}{
+		{"no cues", []Cue{}, "WEBVTT\n"},
+		{
+			"cues",
+			[]Cue{
+				{Start: at(0, 0, 1, 5), End: at(0, 0, 2, 0), Text: "Hello\nworld"},
+				{Start: at(1, 2, 3, 400), End: at(25, 0, 0, 0), Settings: "align:start", Text: "Bye"},
+			},
+			"WEBVTT\n\n00:00:01.005 --> 00:00:02.000\nHello\nworld\n\n01:02:03.400 --> 25:00:00.000 align:start\nBye\n",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := string(WriteWebVTT(test.cues)); got != test.want {
+				t.Fatalf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSubtitlesRoundTrip(t *testing.T) {
+	srt := "\xef\xbb\xbf1\r\n00:00:01,000 --> 00:00:02,000\r\nHello\r\n\r\n2\r\n00:00:03,000 --> 00:00:04,000\r\nBye\r\n"
+	cues, err := ParseSubtitles([]byte(srt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vtt := WriteWebVTT(ShiftCues(cues, -1500*time.Millisecond))
+	want := "WEBVTT\n\n00:00:00.000 --> 00:00:00.500\nHello\n\n00:00:01.500 --> 00:00:02.500\nBye\n"
+	if string(vtt) != want {
+		t.Fatalf("got %q, want %q", vtt, want)
+	}
+	reparsed, err := ParseSubtitles(vtt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reparsed) != 2 || reparsed[1].Start != at(0, 0, 1, 500) {
+		t.Fatalf("got %+v", reparsed)
+	}
+}
@@ -0,0 +1,35 @@
+package media
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Supported video content types
+const (
+	MP4  = "video/mp4"
+	WebM = "video/webm"
+	AVI  = "video/avi"
+)
+
+// VideoExtensions maps supported video content types to file extensions
+var VideoExtensions = map[string]string{
+	MP4:  ".mp4",
+	WebM: ".webm",
+	AVI:  ".avi",
+}
+
+// VideoSniffLength is how many bytes of a video SniffVideo needs to recognize it
+const VideoSniffLength = 512
+
+// ErrUnsupportedVideo is returned for videos that are not MP4, WebM or AVI files
+var ErrUnsupportedVideo = errors.New("video must be an MP4, WebM or AVI file")
+
+// SniffVideo returns the content type of a video from its first bytes
+func SniffVideo(header []byte) (string, error) {
+	contentType := http.DetectContentType(header)
+	if _, ok := VideoExtensions[contentType]; !ok {
+		return "", ErrUnsupportedVideo
+	}
+	return contentType, nil
+}
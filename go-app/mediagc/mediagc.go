@@ -0,0 +1,203 @@
+package mediagc
+
+import (
+	"context"
+	"go-app/repositories/moviesrepo"
+	"go-app/storage"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// Orphan is a stored media file no movie references
+type Orphan struct {
+	Key     string    `json:"key"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+	// Deleted is false for orphans still within the grace period, or that failed to be deleted
+	Deleted bool   `json:"deleted"`
+	Error   string `json:"error,omitempty"`
+}
+
+// MissingFile is a media file referenced by a movie that is not stored
+type MissingFile struct {
+	Key     string             `json:"key"`
+	MovieID primitive.ObjectID `json:"movie_id"`
+}
+
+// Report is the outcome of a garbage collection run
+type Report struct {
+	StartedAt  time.Time     `json:"started_at"`
+	DryRun     bool          `json:"dry_run"`
+	Stored     int           `json:"stored"`
+	Referenced int           `json:"referenced"`
+	Orphans    []Orphan      `json:"orphans"`
+	Missing    []MissingFile `json:"missing"`
+	Deleted    int           `json:"deleted"`
+	// ExpiredUploads are the video uploads which received no bytes for the upload expiry,
+	// deleted along with their local file unless it is a dry run
+	ExpiredUploads []primitive.ObjectID `json:"expired_uploads"`
+	// StaleUploadFiles are the local upload files left without an upload, past the upload expiry
+	StaleUploadFiles []string `json:"stale_upload_files"`
+}
+
+// Collector reconciles the stored media files against the movies referencing them,
+// and expires the video uploads abandoned by clients
+type Collector struct {
+	mr           moviesrepo.Repo
+	store        storage.Storage
+	grace        time.Duration
+	uploadsDir   string
+	uploadExpiry time.Duration
+}
+
+// NewCollector instantiates a Collector deleting orphans older than the grace period,
+// which leaves time for uploads in progress to reference the files they stored, and the
+// video uploads kept in uploadsDir once expired
+func NewCollector(mr moviesrepo.Repo, store storage.Storage, grace time.Duration, uploadsDir string, uploadExpiry time.Duration) *Collector {
+	return &Collector{mr: mr, store: store, grace: grace, uploadsDir: uploadsDir, uploadExpiry: uploadExpiry}
+}
+
+// Run finds orphaned and missing media files, and deletes the orphans past the grace period
+// unless it is a dry run
+func (gc *Collector) Run(ctx context.Context, dryRun bool) (*Report, error) {
+	report := &Report{
+		StartedAt:        time.Now().UTC(),
+		DryRun:           dryRun,
+		Orphans:          []Orphan{},
+		Missing:          []MissingFile{},
+		ExpiredUploads:   []primitive.ObjectID{},
+		StaleUploadFiles: []string{},
+	}
+
+	// Files are listed before references are loaded, so a file stored and referenced
+	// in between is never mistaken for an orphan. Only the prefixes of media files are
+	// listed, anything else under the storage root is not ours to delete.
+	blobs := []storage.BlobInfo{}
+	for _, prefix := range storage.MediaPrefixes {
+		found, err := gc.store.List(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+		blobs = append(blobs, found...)
+	}
+	references, err := gc.mr.MediaReferences()
+	if err != nil {
+		return nil, err
+	}
+	report.Stored = len(blobs)
+	report.Referenced = len(references)
+
+	stored := map[string]bool{}
+	expiredBefore := report.StartedAt.Add(-gc.grace)
+	for _, blob := range blobs {
+		stored[blob.Key] = true
+		if _, ok := references[blob.Key]; ok {
+			continue
+		}
+		orphan := Orphan{Key: blob.Key, Size: blob.Size, ModTime: blob.ModTime}
+		if !dryRun && blob.ModTime.Before(expiredBefore) {
+			if err := gc.store.Delete(ctx, blob.Key); err != nil {
+				orphan.Error = err.Error()
+			} else {
+				orphan.Deleted = true
+				report.Deleted++
+			}
+		}
+		report.Orphans = append(report.Orphans, orphan)
+	}
+	for key, movieID := range references {
+		if !stored[key] {
+			report.Missing = append(report.Missing, MissingFile{Key: key, MovieID: movieID})
+		}
+	}
+	sort.Slice(report.Missing, func(i, j int) bool {
+		return report.Missing[i].Key < report.Missing[j].Key
+	})
+
+	if err := gc.expireUploads(report, dryRun); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// expireUploads deletes the uploads which received no bytes for the upload expiry, then the files
+// of the uploads directory no upload owns anymore, such as those of uploads deleted while writing
+func (gc *Collector) expireUploads(report *Report, dryRun bool) error {
+	uploads, err := gc.mr.ListUploads()
+	if err != nil {
+		return err
+	}
+	known := map[string]bool{}
+	for i := range uploads {
+		upload := &uploads[i]
+		known[upload.ID.Hex()] = true
+		if report.StartedAt.Before(upload.ExpiresAt(gc.uploadExpiry)) {
+			continue
+		}
+		report.ExpiredUploads = append(report.ExpiredUploads, upload.ID)
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(filepath.Join(gc.uploadsDir, upload.ID.Hex())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := gc.mr.DeleteUpload(upload); err != nil {
+			return err
+		}
+	}
+
+	files, err := ioutil.ReadDir(gc.uploadsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	// Upload files are named after their upload, and those of uploads created since the
+	// uploads were listed are newer than the expiry
+	expiredBefore := report.StartedAt.Add(-gc.uploadExpiry)
+	for _, file := range files {
+		if _, err := primitive.ObjectIDFromHex(file.Name()); err != nil || file.IsDir() {
+			continue
+		}
+		if known[file.Name()] || !file.ModTime().Before(expiredBefore) {
+			continue
+		}
+		report.StaleUploadFiles = append(report.StaleUploadFiles, file.Name())
+		if dryRun {
+			continue
+		}
+		if err := os.Remove(filepath.Join(gc.uploadsDir, file.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Sweep runs the collector every interval until the context is done, logging what it found
+func (gc *Collector) Sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			report, err := gc.Run(ctx, false)
+			if err != nil {
+				log.Printf("media gc: %v", err)
+				continue
+			}
+			log.Printf("media gc: %d stored, %d orphans, %d deleted, %d missing, %d expired uploads",
+				report.Stored, len(report.Orphans), report.Deleted, len(report.Missing), len(report.ExpiredUploads))
+			for _, missing := range report.Missing {
+				log.Printf("media gc: %s of movie %s is missing", missing.Key, missing.MovieID.Hex())
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package mediaurls
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"go-app/definitions/users"
+	"go-app/repositories/usersrepo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Query parameters added to signed URLs
+const (
+	ParamUser      = "uid"
+	ParamExpires   = "exp"
+	ParamSignature = "sig"
+	// ParamSaltSignature binds the URL to the media salt of the user, so rotating it revokes the URL
+	ParamSaltSignature = "ssig"
+)
+
+var (
+	// ErrNoSecret is returned when creating a signer without a secret
+	ErrNoSecret = errors.New("media URL secret is not set")
+	// ErrExpired is returned for signed URLs past their expiry
+	ErrExpired = errors.New("media URL has expired")
+	// ErrInvalidSignature is returned for URLs which were not signed by us, were altered or were revoked
+	ErrInvalidSignature = errors.New("invalid media URL signature")
+)
+
+const (
+	// saltCacheTTL bounds how long a salt rotated by another instance keeps old URLs valid,
+	// and how long a role change takes to apply to media URLs
+	saltCacheTTL = time.Minute
+	// saltReloadInterval limits the reloads of a salt triggered by signature mismatches,
+	// which happen when the salt was rotated by another instance
+	saltReloadInterval = 5 * time.Second
+	// saltCacheSize bounds the number of cached salts
+	saltCacheSize = 10000
+)
+
+// cachedSalt is the media salt of a user, along with the role media access is granted with
+type cachedSalt struct {
+	salt     string
+	role     string
+	found    bool
+	loadedAt time.Time
+}
+
+// Signer signs media URLs for a user and validates them. A first signature binds the path, the user
+// and the expiry to a server secret, so forged URLs are rejected without looking anything up.
+// A second one binds the first to a per-user salt, so rotating the salt revokes every URL handed out
+// to the user. Validation is not entirely free of database lookups: the salt of a user is loaded on
+// their first media request, then again once it is older than saltCacheTTL, and at most every
+// saltReloadInterval while salt signatures mismatch. Salts rotated through another instance are only
+// seen once reloaded, so URLs revoked there stay valid here for up to saltCacheTTL.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+	ur     usersrepo.Repo
+
+	mu    sync.Mutex
+	salts map[primitive.ObjectID]cachedSalt
+}
+
+// NewSigner returns a signer handing out URLs valid for at least ttl
+func NewSigner(secret string, ttl time.Duration, ur usersrepo.Repo) (*Signer, error) {
+	if secret == "" {
+		return nil, ErrNoSecret
+	}
+	return &Signer{
+		secret: []byte(secret),
+		ttl:    ttl,
+		ur:     ur,
+		salts:  map[primitive.ObjectID]cachedSalt{},
+	}, nil
+}
+
+// Sign returns the URL, which may have a query, signed for the user
+func (s *Signer) Sign(rawURL string, user *users.User) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+	query := u.Query()
+	query.Del(ParamSignature)
+	query.Del(ParamSaltSignature)
+	query.Set(ParamUser, user.ID.Hex())
+	query.Set(ParamExpires, strconv.FormatInt(s.expiry(time.Now()).Unix(), 10))
+	signature := s.signature(u.Path, query)
+	query.Set(ParamSignature, signature)
+	query.Set(ParamSaltSignature, s.saltSignature(signature, user.MediaSalt))
+	return u.Path + "?" + query.Encode()
+}
+
+// expiry rounds the expiry up to a quarter of the TTL, so the URLs of a movie stay the same
+// for a while and can be cached by clients
+func (s *Signer) expiry(now time.Time) time.Time {
+	step := s.ttl / 4
+	if step <= 0 {
+		return now.Add(s.ttl)
+	}
+	return now.Add(s.ttl).Truncate(step).Add(step)
+}
+
+// Verify validates a signed URL, returning the user it was signed for. The user only has its
+// ID, role and media salt set, which is enough to authorize access to media. The role is the
+// current one of the user, not the one it had when the URL was signed.
+func (s *Signer) Verify(path string, query url.Values) (*users.User, error) {
+	userID, err := primitive.ObjectIDFromHex(query.Get(ParamUser))
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	expires, err := strconv.ParseInt(query.Get(ParamExpires), 10, 64)
+	if err != nil {
+		return nil, ErrInvalidSignature
+	}
+	if time.Now().Unix() > expires {
+		return nil, ErrExpired
+	}
+	signature := query.Get(ParamSignature)
+	if !hmac.Equal([]byte(signature), []byte(s.signature(path, query))) {
+		return nil, ErrInvalidSignature
+	}
+
+	saltSignature := query.Get(ParamSaltSignature)
+	cached, err := s.salt(userID, false)
+	if err != nil {
+		return nil, err
+	}
+	if !hmac.Equal([]byte(saltSignature), []byte(s.saltSignature(signature, cached.salt))) {
+		// The salt may have been rotated by another instance since it was cached
+		if cached, err = s.salt(userID, true); err != nil {
+			return nil, err
+		}
+		if !hmac.Equal([]byte(saltSignature), []byte(s.saltSignature(signature, cached.salt))) {
+			return nil, ErrInvalidSignature
+		}
+	}
+
+	user := &users.User{Role: cached.role, MediaSalt: cached.salt}
+	user.ID = userID
+	return user, nil
+}
+
+// signature computes the signature of the path, the user and the expiry. Other query parameters
+// are left out, so players can add their own, like the offset of subtitles.
+func (s *Signer) signature(path string, query url.Values) string {
+	return s.mac(path + "\n" + query.Get(ParamUser) + "\n" + query.Get(ParamExpires))
+}
+
+// saltSignature computes the signature binding a signature to the media salt of the user
+func (s *Signer) saltSignature(signature string, salt string) string {
+	return s.mac("salt\n" + signature + "\n" + salt)
+}
+
+func (s *Signer) mac(message string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(message))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// salt returns the cached salt of the user, loading it when missing or stale.
+// With reload, it is loaded again unless it was loaded moments ago.
+func (s *Signer) salt(userID primitive.ObjectID, reload bool) (cachedSalt, error) {
+	s.mu.Lock()
+	cached, ok := s.salts[userID]
+	s.mu.Unlock()
+	age := time.Since(cached.loadedAt)
+	if ok && age < saltCacheTTL && (!reload || age < saltReloadInterval) {
+		if !cached.found {
+			return cached, ErrInvalidSignature
+		}
+		return cached, nil
+	}
+
+	user, err := s.ur.FindMediaAccess(userID)
+	if err != nil && err != usersrepo.ErrUserNotFound {
+		return cachedSalt{}, err
+	}
+	cached = cachedSalt{found: err == nil, loadedAt: time.Now()}
+	if user != nil {
+		cached.salt, cached.role = user.MediaSalt, user.Role
+	}
+	s.store(userID, cached)
+	if !cached.found {
+		return cached, ErrInvalidSignature
+	}
+	return cached, nil
+}
+
+// SetSalt updates the cached salt of a user after it was rotated, revoking the URLs signed
+// with the previous one right away on this instance
+func (s *Signer) SetSalt(user *users.User) {
+	s.store(user.ID, cachedSalt{salt: user.MediaSalt, role: user.Role, found: true, loadedAt: time.Now()})
+}
+
+// store caches the salt of a user. When the cache is full, stale salts are evicted,
+// or else the least recently loaded one.
+func (s *Signer) store(userID primitive.ObjectID, entry cachedSalt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.salts[userID]; !ok && len(s.salts) >= saltCacheSize {
+		var oldestID primitive.ObjectID
+		var oldest time.Time
+		for id, cached := range s.salts {
+			if time.Since(cached.loadedAt) >= saltCacheTTL {
+				delete(s.salts, id)
+			} else if oldest.IsZero() || cached.loadedAt.Before(oldest) {
+				oldestID, oldest = id, cached.loadedAt
+			}
+		}
+		if len(s.salts) >= saltCacheSize {
+			delete(s.salts, oldestID)
+		}
+	}
+	s.salts[userID] = entry
+}
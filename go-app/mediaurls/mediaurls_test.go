@@ -0,0 +1,247 @@
+package mediaurls
+
+import (
+	"go-app/definitions/users"
+	"go-app/repositories/usersrepo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeUsers serves the media access of users from memory, counting the lookups
+type fakeUsers struct {
+	usersrepo.Repo
+	users   map[primitive.ObjectID]*users.User
+	lookups int
+}
+
+func (f *fakeUsers) FindMediaAccess(id primitive.ObjectID) (*users.User, error) {
+	f.lookups++
+	user, ok := f.users[id]
+	if !ok {
+		return nil, usersrepo.ErrUserNotFound
+	}
+	access := &users.User{Role: user.Role, MediaSalt: user.MediaSalt}
+	access.ID = id
+	return access, nil
+}
+
+func newTestUser(role string, salt string) *users.User {
+	user := &users.User{Role: role, MediaSalt: salt}
+	user.ID = primitive.NewObjectID()
+	return user
+}
+
+func newTestSigner(t *testing.T, known ...*users.User) (*Signer, *fakeUsers) {
+	repo := &fakeUsers{users: map[primitive.ObjectID]*users.User{}}
+	for _, user := range known {
+		repo.users[user.ID] = user
+	}
+	signer, err := NewSigner("test-secret", time.Hour, repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer, repo
+}
+
+// verifyURL verifies a URL the way the media middleware does
+func verifyURL(signer *Signer, rawURL string) (*users.User, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return signer.Verify(u.Path, u.Query())
+}
+
+// withParam returns the URL with a query parameter replaced
+func withParam(rawURL string, key string, value string) string {
+	u, _ := url.Parse(rawURL)
+	query := u.Query()
+	query.Set(key, value)
+	return u.Path + "?" + query.Encode()
+}
+
+func TestNewSignerRequiresSecret(t *testing.T) {
+	if _, err := NewSigner("", time.Hour, &fakeUsers{}); err != ErrNoSecret {
+		t.Fatalf("got %v, want %v", err, ErrNoSecret)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	user := newTestUser("", "salt")
+	other := newTestUser("", "other-salt")
+	signer, _ := newTestSigner(t, user, other)
+	signed := signer.Sign("/movie/stream/abc/subtitles/en/", user)
+	expired := strconv.FormatInt(time.Now().Add(-time.Minute).Unix(), 10)
+
+	tests := []struct {
+		name string
+		url  string
+		want error
+	}{
+		{"signed", signed, nil},
+		{"extra parameter", signed + "&offset=-1.5s", nil},
+		{"other path", strings.Replace(signed, "/en/", "/fr/", 1), ErrInvalidSignature},
+		{"other user", withParam(signed, ParamUser, other.ID.Hex()), ErrInvalidSignature},
+		{"invalid user", withParam(signed, ParamUser, "nope"), ErrInvalidSignature},
+		{"later expiry", withParam(signed, ParamExpires, strconv.FormatInt(time.Now().Add(48*time.Hour).Unix(), 10)), ErrInvalidSignature},
+		{"expired", withParam(signed, ParamExpires, expired), ErrExpired},
+		{"invalid expiry", withParam(signed, ParamExpires, "soon"), ErrInvalidSignature},
+		{"altered signature", withParam(signed, ParamSignature, "AAAA"), ErrInvalidSignature},
+		{"altered salt signature", withParam(signed, ParamSaltSignature, "AAAA"), ErrInvalidSignature},
+		{"other secret", (&Signer{secret: []byte("other"), ttl: time.Hour}).Sign("/movie/stream/abc/", user), ErrInvalidSignature},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := verifyURL(signer, test.url)
+			if err != test.want {
+				t.Fatalf("got %v, want %v", err, test.want)
+			}
+			if err == nil && got.ID != user.ID {
+				t.Fatalf("got user %s, want %s", got.ID.Hex(), user.ID.Hex())
+			}
+		})
+	}
+}
+
+func TestVerifyForgedURLsSkipLookup(t *testing.T) {
+	signer, repo := newTestSigner(t)
+	exp := strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10)
+	for i := 0; i < 10; i++ {
+		forged := "/movie/stream/abc/?uid=" + primitive.NewObjectID().Hex() + "&exp=" + exp + "&sig=AAAA&ssig=AAAA"
+		if _, err := verifyURL(signer, forged); err != ErrInvalidSignature {
+			t.Fatalf("got %v, want %v", err, ErrInvalidSignature)
+		}
+	}
+	if repo.lookups != 0 || len(signer.salts) != 0 {
+		t.Fatalf("forged URLs caused %d lookups and %d cached salts", repo.lookups, len(signer.salts))
+	}
+}
+
+func TestVerifyCachesSalt(t *testing.T) {
+	user := newTestUser("", "salt")
+	signer, repo := newTestSigner(t, user)
+	signed := signer.Sign("/movie/stream/abc/", user)
+	for i := 0; i < 3; i++ {
+		if _, err := verifyURL(signer, signed); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if repo.lookups != 1 {
+		t.Fatalf("got %d lookups, want 1", repo.lookups)
+	}
+}
+
+func TestVerifyUnknownUser(t *testing.T) {
+	signer, _ := newTestSigner(t)
+	signed := signer.Sign("/movie/stream/abc/", newTestUser("", "salt"))
+	if _, err := verifyURL(signer, signed); err != ErrInvalidSignature {
+		t.Fatalf("got %v, want %v", err, ErrInvalidSignature)
+	}
+}
+
+func TestVerifyRole(t *testing.T) {
+	tests := []struct {
+		name       string
+		signedRole string
+		storedRole string
+	}{
+		{"unchanged", users.RoleModerator, users.RoleModerator},
+		{"demoted", users.RoleAdmin, ""},
+		{"promoted", "", users.RoleModerator},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			user := newTestUser(test.signedRole, "salt")
+			signer, repo := newTestSigner(t, user)
+			signed := signer.Sign("/movie/stream/abc/", user)
+			repo.users[user.ID] = newTestUser(test.storedRole, "salt")
+			got, err := verifyURL(signer, signed)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Role != test.storedRole {
+				t.Fatalf("got role %q, want %q", got.Role, test.storedRole)
+			}
+		})
+	}
+}
+
+func TestRotation(t *testing.T) {
+	user := newTestUser("", "salt")
+	signer, repo := newTestSigner(t, user)
+	before := signer.Sign("/movie/stream/abc/", user)
+	if _, err := verifyURL(signer, before); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated := newTestUser("", "rotated")
+	rotated.ID = user.ID
+	repo.users[user.ID] = rotated
+	signer.SetSalt(rotated)
+	after := signer.Sign("/movie/stream/abc/", rotated)
+
+	tests := []struct {
+		name string
+		url  string
+		want error
+	}{
+		{"signed before rotation", before, ErrInvalidSignature},
+		{"signed after rotation", after, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := verifyURL(signer, test.url); err != test.want {
+				t.Fatalf("got %v, want %v", err, test.want)
+			}
+		})
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	signer := &Signer{ttl: 4 * time.Hour}
+	now := time.Date(2021, 3, 1, 10, 20, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"rounded up", now, time.Date(2021, 3, 1, 15, 0, 0, 0, time.UTC)},
+		{"same step", now.Add(30 * time.Minute), time.Date(2021, 3, 1, 15, 0, 0, 0, time.UTC)},
+		{"next step", now.Add(40 * time.Minute), time.Date(2021, 3, 1, 16, 0, 0, 0, time.UTC)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := signer.expiry(test.now); !got.Equal(test.want) {
+				t.Fatalf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestStoreEvictsOneSalt(t *testing.T) {
+	signer, _ := newTestSigner(t)
+	var oldest primitive.ObjectID
+	for i := 0; i < saltCacheSize; i++ {
+		id := primitive.NewObjectID()
+		if i == 0 {
+			oldest = id
+		}
+		signer.store(id, cachedSalt{found: true, loadedAt: time.Now().Add(time.Duration(i-saltCacheSize) * time.Millisecond)})
+	}
+	newest := primitive.NewObjectID()
+	signer.store(newest, cachedSalt{found: true, loadedAt: time.Now()})
+
+	if len(signer.salts) != saltCacheSize {
+		t.Fatalf("got %d cached salts, want %d", len(signer.salts), saltCacheSize)
+	}
+	if _, ok := signer.salts[oldest]; ok {
+		t.Fatal("oldest salt was not evicted")
+	}
+	if _, ok := signer.salts[newest]; !ok {
+		t.Fatal("newest salt was not cached")
+	}
+}
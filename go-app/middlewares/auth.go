@@ -13,9 +13,22 @@ import (
 
 // Authorize validates token and authorizes users
 func Authorize() gin.HandlerFunc {
+	return authenticate(true)
+}
+
+// Authenticate sets the current user when a token is provided, and lets anonymous requests through
+func Authenticate() gin.HandlerFunc {
+	return authenticate(false)
+}
+
+func authenticate(required bool) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		clientToken := c.Request.Header.Get("Authorization")
 		if clientToken == "" {
+			if !required {
+				c.Next()
+				return
+			}
 			controllers.HTTPRes(c, http.StatusForbidden, "No Authorization header provided", nil)
 			c.Abort()
 			return
@@ -0,0 +1,44 @@
+package middlewares
+
+import (
+	"github.com/gin-gonic/gin"
+	"go-app/controllers"
+	"go-app/mediaurls"
+	"net/http"
+)
+
+// AuthorizeMedia authorizes requests to media with a signed URL, which players can use without
+// sending a token, or with a token like Authorize
+func AuthorizeMedia(signer *mediaurls.Signer) gin.HandlerFunc {
+	return authenticateMedia(signer, true)
+}
+
+// AuthenticateMedia sets the current user from a signed URL or a token, and lets anonymous requests through
+func AuthenticateMedia(signer *mediaurls.Signer) gin.HandlerFunc {
+	return authenticateMedia(signer, false)
+}
+
+func authenticateMedia(signer *mediaurls.Signer, required bool) gin.HandlerFunc {
+	tokenAuth := authenticate(required)
+	return func(c *gin.Context) {
+		if c.Query(mediaurls.ParamSignature) == "" {
+			tokenAuth(c)
+			return
+		}
+
+		currentUser, err := signer.Verify(c.Request.URL.Path, c.Request.URL.Query())
+		if err != nil {
+			if err == mediaurls.ErrExpired || err == mediaurls.ErrInvalidSignature {
+				controllers.HTTPRes(c, http.StatusForbidden, "Invalid media URL", err.Error())
+			} else {
+				controllers.HTTPRes(c, http.StatusInternalServerError, "Error while validating media URL", err.Error())
+			}
+			c.Abort()
+			return
+		}
+
+		c.Set("user", currentUser)
+
+		c.Next()
+	}
+}
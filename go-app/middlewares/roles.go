@@ -0,0 +1,23 @@
+package middlewares
+
+import (
+	"go-app/controllers"
+	"go-app/definitions/users"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireRole only lets through users having one of the roles, it must run after Authorize
+func RequireRole(roles ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		currentUser := c.MustGet("user").(*users.User)
+		if !currentUser.HasRole(roles...) {
+			controllers.HTTPRes(c, http.StatusForbidden, "Insufficient permissions", nil)
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -1,18 +1,92 @@
 package moviesrepo
 
 import (
+	"errors"
 	"github.com/kamva/mgm/v3"
+	"github.com/kamva/mgm/v3/builder"
+	"github.com/kamva/mgm/v3/operator"
 	"go-app/definitions/movies"
 	"go-app/definitions/users"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// ErrPreconditionFailed is returned when a movie was modified since it was loaded
+var ErrPreconditionFailed = errors.New("movie was modified by another request")
+
+// ErrRevisionNotFound is returned when a movie has no revision with the requested number
+var ErrRevisionNotFound = errors.New("revision not found")
+
+// untrackedFields are movie fields that are not part of a revision diff
+// Permissions are left out too so that reverting a revision never changes who can edit a movie.
+var untrackedFields = map[string]bool{
+	"_id": true, "created_at": true, "updated_at": true, "normalized_name": true, "added_by": true, "editors": true,
+	"status": true, "rejection_reason": true, "cover": true, "video": true,
+	"subtitles": true,
+}
+
+// duplicateSimilarity is the minimum title similarity for a movie to be reported as a duplicate
+const duplicateSimilarity = 0.8
+
 // Repo Interface
 type Repo interface {
+	EnsureIndexes() error
+	FindByExternalID(externalID string) (*movies.Movie, error)
+	FindDuplicates(movie *movies.Movie, viewer *users.User) ([]movies.DuplicateCandidate, error)
+	MergeMovies(survivor *movies.Movie, duplicates []*movies.Movie) (*movies.MergeResult, error)
+	ListCollaborators(movie *movies.Movie) ([]movies.Collaborator, error)
+	AddEditor(movie *movies.Movie, user *users.User) error
+	RemoveEditor(movie *movies.Movie, userID primitive.ObjectID) error
+	TransferOwnership(movie *movies.Movie, user *users.User) error
+	SetStatus(movie *movies.Movie, from []string, to string, reason string) error
+	SaveMovie(movie *movies.Movie) error
+	UpdateMovie(movie *movies.Movie) error
+	SetCover(movie *movies.Movie, cover *movies.CoverInfo) error
+	SetVideo(movie *movies.Movie, video *movies.VideoInfo) error
+	SetSubtitles(movie *movies.Movie, subtitles []movies.SubtitleTrack) error
+	AdvanceUpload(upload *movies.VideoUpload, from int64) error
+	ListUploads() ([]movies.VideoUpload, error)
+	DeleteUpload(upload *movies.VideoUpload) error
+	MediaReferences() (map[string]primitive.ObjectID, error)
+	SaveRendition(movie *movies.Movie, name string, input *movies.RenditionInput) (*movies.VideoRendition, error)
+	FindRendition(movie *movies.Movie, name string) (*movies.VideoRendition, error)
+	ListRenditions(movie *movies.Movie) ([]movies.VideoRendition, error)
+	SetSegment(rendition *movies.VideoRendition, index int, segment movies.VideoSegment) error
+	SetInitSegment(rendition *movies.VideoRendition, key string) error
+	DeleteRendition(rendition *movies.VideoRendition) error
+	DeleteMovie(movie *movies.Movie) error
 	AddToWatchedList(watchEntry *movies.WatchedMovieEntry) error
 	DidWatchMovie(movie *movies.Movie, user *users.User) (bool, error)
+	FindProgress(movieID primitive.ObjectID, userID primitive.ObjectID) (*movies.PlaybackProgress, error)
+	SaveProgress(progress *movies.PlaybackProgress) error
+	ListInProgress(userID primitive.ObjectID, since time.Time, skip int64, limit int64) ([]movies.PlaybackProgress, error)
+	DismissProgress(movieID primitive.ObjectID, userID primitive.ObjectID) error
+	ListWatchlist(userID primitive.ObjectID) ([]movies.WatchlistEntry, error)
+	AddToWatchlist(movieID primitive.ObjectID, userID primitive.ObjectID) error
+	RemoveFromWatchlist(movieID primitive.ObjectID, userID primitive.ObjectID) error
+	ReorderWatchlist(userID primitive.ObjectID, movieIDs []primitive.ObjectID) error
+	InWatchlist(userID primitive.ObjectID, movieIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error)
+	SaveCollection(collection *movies.MovieCollection) error
+	FindCollection(id primitive.ObjectID) (*movies.MovieCollection, error)
+	FindSharedCollection(token string) (*movies.MovieCollection, error)
+	DeleteCollection(collection *movies.MovieCollection) error
+	ListCollections(ownerID primitive.ObjectID) ([]movies.CollectionSummary, error)
+	ListPublicCollections(skip int64, limit int64) ([]movies.CollectionSummary, error)
 	ReviewMovie(reviewEntry *movies.ReviewMovieEntry) error
+	SaveMovieWithRevision(before *movies.Movie, movie *movies.Movie, user *users.User) error
+	UpdateMovieWithRevision(before *movies.Movie, movie *movies.Movie, user *users.User) error
+	ListRevisions(movie *movies.Movie) ([]movies.MovieRevisionInfo, error)
+	GetRevision(movie *movies.Movie, rev int) (*movies.MovieRevision, error)
+	RevertRevision(movie *movies.Movie, revision *movies.MovieRevision, user *users.User) error
 }
 type moviesRepo struct {
 	db *mongo.Client
@@ -25,14 +99,600 @@ func NewMoviesRepo(db *mongo.Client) Repo {
 	}
 }
 
+// uniqueIndex is a unique index of the collection of model. Sparse indexes leave out the documents
+// without the indexed field.
+type uniqueIndex struct {
+	model  mgm.Model
+	keys   bson.D
+	sparse bool
+}
+
+// uniqueIndexes keep concurrent requests from creating the same entry twice
+var uniqueIndexes = []uniqueIndex{
+	{&movies.WatchlistEntry{}, bson.D{{Key: "user_id", Value: 1}, {Key: "movie_id", Value: 1}}, false},
+	{&movies.PlaybackProgress{}, bson.D{{Key: "user_id", Value: 1}, {Key: "movie_id", Value: 1}}, false},
+	// Only imported movies have an external key
+	{&movies.Movie{}, bson.D{{Key: "external_id", Value: 1}}, true},
+}
+
+// EnsureIndexes creates the unique indexes the repository relies on. An index can't be created
+// while duplicates created before it existed remain, the other indexes are created anyway.
+func (b *moviesRepo) EnsureIndexes() error {
+	var failed []string
+	for _, index := range uniqueIndexes {
+		coll := mgm.Coll(index.model)
+		_, err := coll.Indexes().CreateOne(mgm.Ctx(), mongo.IndexModel{
+			Keys:    index.keys,
+			Options: options.Index().SetUnique(true).SetSparse(index.sparse),
+		})
+		if err != nil {
+			failed = append(failed, coll.Name()+": "+err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New("creating indexes failed, " + strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// FindByExternalID returns the movie imported with the given external key, or nil if there is none
+func (b *moviesRepo) FindByExternalID(externalID string) (*movies.Movie, error) {
+	movie := &movies.Movie{}
+	err := mgm.Coll(movie).First(bson.M{"external_id": externalID}, movie)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return movie, nil
+}
+
+// FindDuplicates returns the movies likely to be the same as the given one: movies released
+// the same year with a similar title, or with the same title when a release date is unknown.
+// Only movies the viewer can see are returned, others' drafts stay hidden.
+func (b *moviesRepo) FindDuplicates(movie *movies.Movie, viewer *users.User) ([]movies.DuplicateCandidate, error) {
+	normalized := movies.NormalizeTitle(movie.Name)
+	var filters bson.A
+	if movie.Date.IsZero() {
+		filters = bson.A{bson.M{"normalized_name": normalized}}
+	} else {
+		year := movies.NewReleaseDate(movie.Date.Time, movies.PrecisionYear)
+		filters = bson.A{
+			bson.M{"date": bson.M{operator.Gte: year.Time, operator.Lt: year.End}},
+			bson.M{"normalized_name": normalized, "date": nil},
+		}
+	}
+
+	found := []movies.Movie{}
+	err := mgm.Coll(movie).SimpleFind(&found, bson.M{operator.Or: filters})
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := []movies.DuplicateCandidate{}
+	for _, existing := range found {
+		if existing.ID == movie.ID || !existing.CanView(viewer) {
+			continue
+		}
+		similarity := movies.TitleSimilarity(normalized, movies.NormalizeTitle(existing.Name))
+		if similarity < duplicateSimilarity {
+			continue
+		}
+		candidates = append(candidates, movies.DuplicateCandidate{
+			ID:         existing.ID,
+			Name:       existing.Name,
+			Date:       existing.Date,
+			Similarity: math.Round(similarity*100) / 100,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		return candidates[i].Similarity > candidates[j].Similarity
+	})
+	return candidates, nil
+}
+
+// MergeMovies moves the reviews, watch entries, playback progress and watchlist entries of the duplicates
+// onto the survivor, then deletes the duplicates. When a user has an entry on both, the most recently
+// updated one is kept. Collections list the survivor instead of the duplicates.
+// Ratings are computed from the reviews when movies are read, so they follow the moved reviews.
+// Duplicates listed twice, and the survivor itself, are skipped. On failure the result reports what
+// was applied before it, as the merge is not rolled back.
+func (b *moviesRepo) MergeMovies(survivor *movies.Movie, duplicates []*movies.Movie) (*movies.MergeResult, error) {
+	result := &movies.MergeResult{}
+	merged := map[primitive.ObjectID]bool{survivor.ID: true}
+	for _, duplicate := range duplicates {
+		if merged[duplicate.ID] {
+			continue
+		}
+		merged[duplicate.ID] = true
+
+		moved, dropped, err := mergeEntries(&movies.ReviewMovieEntry{}, survivor, duplicate)
+		result.ReviewsMoved += moved
+		result.EntriesDropped += dropped
+		if err != nil {
+			return result, err
+		}
+
+		moved, dropped, err = mergeEntries(&movies.WatchedMovieEntry{}, survivor, duplicate)
+		result.WatchedMoved += moved
+		result.EntriesDropped += dropped
+		if err != nil {
+			return result, err
+		}
+
+		moved, dropped, err = mergeEntries(&movies.PlaybackProgress{}, survivor, duplicate)
+		result.ProgressMoved += moved
+		result.EntriesDropped += dropped
+		if err != nil {
+			return result, err
+		}
+
+		moved, dropped, err = mergeEntries(&movies.WatchlistEntry{}, survivor, duplicate)
+		result.WatchlistMoved += moved
+		result.EntriesDropped += dropped
+		if err != nil {
+			return result, err
+		}
+
+		if err = replaceInCollections(survivor, duplicate); err != nil {
+			return result, err
+		}
+
+		if _, err := mgm.Coll(duplicate).DeleteOne(mgm.Ctx(), bson.M{"_id": duplicate.ID}); err != nil {
+			return result, err
+		}
+		result.Merged++
+		if err := deleteRenditions(duplicate); err != nil {
+			return result, err
+		}
+	}
+	return result, nil
+}
+
+// userEntry is the part shared by the per user entries of a movie
+type userEntry struct {
+	ID        primitive.ObjectID `bson:"_id"`
+	UserID    primitive.ObjectID `bson:"user_id"`
+	UpdatedAt time.Time          `bson:"updated_at"`
+}
+
+// mergeEntries moves the per user entries stored in the collection of model from the duplicate
+// to the survivor, keeping only the most recently updated entry of each user
+func mergeEntries(model mgm.Model, survivor *movies.Movie, duplicate *movies.Movie) (moved int, dropped int, err error) {
+	coll := mgm.Coll(model)
+
+	kept := map[primitive.ObjectID]userEntry{}
+	survivorEntries := []userEntry{}
+	if err = coll.SimpleFind(&survivorEntries, bson.M{"movie_id": survivor.ID}); err != nil {
+		return
+	}
+	for _, entry := range survivorEntries {
+		kept[entry.UserID] = entry
+	}
+
+	duplicateEntries := []userEntry{}
+	if err = coll.SimpleFind(&duplicateEntries, bson.M{"movie_id": duplicate.ID}); err != nil {
+		return
+	}
+	for _, entry := range duplicateEntries {
+		existing, found := kept[entry.UserID]
+		if found && !entry.UpdatedAt.After(existing.UpdatedAt) {
+			if _, err = coll.DeleteOne(mgm.Ctx(), bson.M{"_id": entry.ID}); err != nil {
+				return
+			}
+			dropped++
+			continue
+		}
+		if found {
+			if _, err = coll.DeleteOne(mgm.Ctx(), bson.M{"_id": existing.ID}); err != nil {
+				return
+			}
+			dropped++
+		}
+		if _, err = coll.UpdateOne(mgm.Ctx(), bson.M{"_id": entry.ID}, bson.M{operator.Set: bson.M{"movie_id": survivor.ID}}); err != nil {
+			return
+		}
+		kept[entry.UserID] = entry
+		moved++
+	}
+	return
+}
+
+// ListCollaborators returns the owner of the movie followed by its editors
+func (b *moviesRepo) ListCollaborators(movie *movies.Movie) ([]movies.Collaborator, error) {
+	found := []users.User{}
+	ids := append([]primitive.ObjectID{movie.AddedBy}, movie.Editors...)
+	err := mgm.Coll(&users.User{}).SimpleFind(&found, bson.M{"_id": bson.M{operator.In: ids}})
+	if err != nil {
+		return nil, err
+	}
+
+	byID := map[primitive.ObjectID]users.User{}
+	for _, user := range found {
+		byID[user.ID] = user
+	}
+	collaborators := []movies.Collaborator{}
+	for i, id := range ids {
+		user, ok := byID[id]
+		if !ok {
+			continue
+		}
+		role := movies.CollaboratorEditor
+		if i == 0 {
+			role = movies.CollaboratorOwner
+		}
+		collaborators = append(collaborators, movies.Collaborator{
+			ID:       user.ID,
+			FullName: user.FullName,
+			Email:    user.Email,
+			Role:     role,
+		})
+	}
+	return collaborators, nil
+}
+
+// AddEditor grants the user editor rights on the movie, provided it was not modified since it was loaded
+func (b *moviesRepo) AddEditor(movie *movies.Movie, user *users.User) error {
+	return b.updatePermissions(movie, bson.M{
+		operator.AddToSet: bson.M{"editors": user.ID},
+	})
+}
+
+// RemoveEditor revokes the editor rights of the user on the movie, provided it was not modified since it was loaded
+func (b *moviesRepo) RemoveEditor(movie *movies.Movie, userID primitive.ObjectID) error {
+	return b.updatePermissions(movie, bson.M{
+		operator.Pull: bson.M{"editors": userID},
+	})
+}
+
+// TransferOwnership makes the user the owner of the movie, provided it was not modified since it was loaded.
+// The previous owner keeps editing the movie as one of its editors.
+func (b *moviesRepo) TransferOwnership(movie *movies.Movie, user *users.User) error {
+	editors := []primitive.ObjectID{movie.AddedBy}
+	for _, editor := range movie.Editors {
+		if editor != user.ID && editor != movie.AddedBy {
+			editors = append(editors, editor)
+		}
+	}
+	return b.updatePermissions(movie, bson.M{
+		operator.Set: bson.M{"added_by": user.ID, "editors": editors},
+	})
+}
+
+// updatePermissions applies a change of who may edit the movie, provided it was not modified since it
+// was loaded. The movie is modified, so the ETags handed out before the change stop matching.
+func (b *moviesRepo) updatePermissions(movie *movies.Movie, update bson.M) error {
+	set, _ := update[operator.Set].(bson.M)
+	if set == nil {
+		set = bson.M{}
+		update[operator.Set] = set
+	}
+	set["updated_at"] = time.Now().UTC()
+	res, err := mgm.Coll(movie).UpdateOne(mgm.Ctx(), versionFilter(movie.ID, movie.UpdatedAt), update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPreconditionFailed
+	}
+	return mgm.Coll(movie).FindByID(movie.ID, movie)
+}
+
+// ErrInvalidTransition is returned when a movie is not in a status it can leave for the requested one
+var ErrInvalidTransition = errors.New("movie status does not allow this change")
+
+// SetStatus moves the movie to a new status, provided it currently is in one of the from statuses.
+// The rejection reason is kept only for rejected movies.
+func (b *moviesRepo) SetStatus(movie *movies.Movie, from []string, to string, reason string) error {
+	update := bson.M{operator.Set: bson.M{"status": to}}
+	if to == movies.StatusRejected {
+		update[operator.Set] = bson.M{"status": to, "rejection_reason": reason}
+	} else {
+		update[operator.Unset] = bson.M{"rejection_reason": ""}
+	}
+
+	res, err := mgm.Coll(movie).UpdateOne(mgm.Ctx(), bson.M{"_id": movie.ID, "status": bson.M{operator.In: from}}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrInvalidTransition
+	}
+	return mgm.Coll(movie).FindByID(movie.ID, movie)
+}
+
+// versionFilter matches a movie only if it was not updated since updatedAt
+func versionFilter(id primitive.ObjectID, updatedAt time.Time) bson.M {
+	return bson.M{"_id": id, "updated_at": updatedAt}
+}
+
+// SaveMovie replaces the stored movie with the given one, so fields left empty are cleared.
+// The movie must not have been modified since it was loaded.
+func (b *moviesRepo) SaveMovie(movie *movies.Movie) error {
+	expected := movie.UpdatedAt
+	if err := movie.Saving(); err != nil {
+		return err
+	}
+	res, err := mgm.Coll(movie).ReplaceOne(mgm.Ctx(), versionFilter(movie.ID, expected), movie)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		movie.UpdatedAt = expected
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// UpdateMovie sets the non-empty fields of the movie.
+// The movie must not have been modified since it was loaded.
+func (b *moviesRepo) UpdateMovie(movie *movies.Movie) error {
+	expected := movie.UpdatedAt
+	if err := movie.Saving(); err != nil {
+		return err
+	}
+	res, err := mgm.Coll(movie).UpdateOne(mgm.Ctx(), versionFilter(movie.ID, expected), bson.M{operator.Set: movie})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		movie.UpdatedAt = expected
+		return ErrPreconditionFailed
+	}
+	return nil
+}
+
+// SetCover records the new cover of the movie, provided it was not modified since it was loaded
+func (b *moviesRepo) SetCover(movie *movies.Movie, cover *movies.CoverInfo) error {
+	expected := movie.UpdatedAt
+	now := time.Now().UTC()
+	res, err := mgm.Coll(movie).UpdateOne(mgm.Ctx(), versionFilter(movie.ID, expected), bson.M{
+		operator.Set: bson.M{"cover": cover, "updated_at": now},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPreconditionFailed
+	}
+	movie.Cover = cover
+	movie.UpdatedAt = now
+	return nil
+}
+
+// SetSubtitles replaces the subtitle tracks of the movie, provided it was not modified since it was loaded
+func (b *moviesRepo) SetSubtitles(movie *movies.Movie, subtitles []movies.SubtitleTrack) error {
+	expected := movie.UpdatedAt
+	now := time.Now().UTC()
+	res, err := mgm.Coll(movie).UpdateOne(mgm.Ctx(), versionFilter(movie.ID, expected), bson.M{
+		operator.Set: bson.M{"subtitles": subtitles, "updated_at": now},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPreconditionFailed
+	}
+	movie.Subtitles = subtitles
+	movie.UpdatedAt = now
+	return nil
+}
+
+// SetVideo records the video of the movie. Uploads last long enough for the movie to be edited
+// in the meantime, so unlike other changes the video is set whatever the movie version.
+func (b *moviesRepo) SetVideo(movie *movies.Movie, video *movies.VideoInfo) error {
+	now := time.Now().UTC()
+	res, err := mgm.Coll(movie).UpdateOne(mgm.Ctx(), bson.M{"_id": movie.ID}, bson.M{
+		operator.Set: bson.M{"video": video, "updated_at": now},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	movie.Video = video
+	movie.UpdatedAt = now
+	return nil
+}
+
+// AdvanceUpload records the new offset and content type of the upload,
+// provided its offset was still from, so concurrent requests cannot both append
+func (b *moviesRepo) AdvanceUpload(upload *movies.VideoUpload, from int64) error {
+	now := time.Now().UTC()
+	res, err := mgm.Coll(upload).UpdateOne(mgm.Ctx(), bson.M{"_id": upload.ID, "offset": from}, bson.M{
+		operator.Set: bson.M{"offset": upload.Offset, "content_type": upload.ContentType, "updated_at": now},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return ErrPreconditionFailed
+	}
+	upload.UpdatedAt = now
+	return nil
+}
+
+// ListUploads returns the video uploads in progress
+func (b *moviesRepo) ListUploads() ([]movies.VideoUpload, error) {
+	uploads := []movies.VideoUpload{}
+	err := mgm.Coll(&movies.VideoUpload{}).SimpleFind(&uploads, bson.M{})
+	return uploads, err
+}
+
+// DeleteUpload deletes the upload, its local file is left to the caller
+func (b *moviesRepo) DeleteUpload(upload *movies.VideoUpload) error {
+	return mgm.Coll(upload).Delete(upload)
+}
+
+// MediaReferences maps the storage keys of every media file referenced by a movie to the movie
+func (b *moviesRepo) MediaReferences() (map[string]primitive.ObjectID, error) {
+	cursor, err := mgm.Coll(&movies.Movie{}).Find(
+		mgm.Ctx(),
+		bson.M{operator.Or: bson.A{
+			bson.M{"cover": bson.M{operator.Exists: true}},
+			bson.M{"video": bson.M{operator.Exists: true}},
+			bson.M{"subtitles": bson.M{operator.Exists: true}},
+		}},
+		options.Find().SetProjection(bson.M{"cover": 1, "video": 1, "subtitles": 1}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(mgm.Ctx())
+
+	references := map[string]primitive.ObjectID{}
+	for cursor.Next(mgm.Ctx()) {
+		movie := &movies.Movie{}
+		if err := cursor.Decode(movie); err != nil {
+			return nil, err
+		}
+		if movie.Cover != nil {
+			references[movie.Cover.Key] = movie.ID
+			for _, rendition := range movie.Cover.Renditions {
+				references[rendition.Key] = movie.ID
+			}
+		}
+		if movie.Video != nil {
+			references[movie.Video.Key] = movie.ID
+		}
+		for _, track := range movie.Subtitles {
+			references[track.Key] = movie.ID
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	renditions := []movies.VideoRendition{}
+	if err := mgm.Coll(&movies.VideoRendition{}).SimpleFind(&renditions, bson.M{}); err != nil {
+		return nil, err
+	}
+	for _, rendition := range renditions {
+		if rendition.InitKey != "" {
+			references[rendition.InitKey] = rendition.MovieID
+		}
+		for _, segment := range rendition.Segments {
+			references[segment.Key] = rendition.MovieID
+		}
+	}
+	return references, nil
+}
+
+// SaveRendition creates or updates the rendition of the movie with the given name.
+// Segments are dropped when the container changes, as they cannot be played anymore.
+func (b *moviesRepo) SaveRendition(movie *movies.Movie, name string, input *movies.RenditionInput) (*movies.VideoRendition, error) {
+	rendition, err := b.FindRendition(movie, name)
+	if err != nil {
+		return nil, err
+	}
+	if rendition == nil {
+		rendition = &movies.VideoRendition{MovieID: movie.ID, Name: name}
+	} else if rendition.Container != input.Container {
+		rendition.InitKey = ""
+		rendition.Segments = nil
+	}
+	rendition.Bandwidth = input.Bandwidth
+	rendition.Width = input.Width
+	rendition.Height = input.Height
+	rendition.Codecs = input.Codecs
+	rendition.Container = input.Container
+	if rendition.ID.IsZero() {
+		err = mgm.Coll(rendition).Create(rendition)
+	} else {
+		err = mgm.Coll(rendition).Update(rendition)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return rendition, nil
+}
+
+// FindRendition returns the rendition of the movie with the given name, or nil if there is none
+func (b *moviesRepo) FindRendition(movie *movies.Movie, name string) (*movies.VideoRendition, error) {
+	rendition := &movies.VideoRendition{}
+	err := mgm.Coll(rendition).First(bson.M{"movie_id": movie.ID, "name": name}, rendition)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return rendition, nil
+}
+
+// ListRenditions returns the renditions of the movie, from the lowest to the highest bitrate
+func (b *moviesRepo) ListRenditions(movie *movies.Movie) ([]movies.VideoRendition, error) {
+	renditions := []movies.VideoRendition{}
+	err := mgm.Coll(&movies.VideoRendition{}).SimpleFind(
+		&renditions,
+		bson.M{"movie_id": movie.ID},
+		options.Find().SetSort(bson.M{"bandwidth": 1}),
+	)
+	return renditions, err
+}
+
+// SetSegment records a media segment of the rendition, replacing any segment at the same index
+func (b *moviesRepo) SetSegment(rendition *movies.VideoRendition, index int, segment movies.VideoSegment) error {
+	field := "segments." + strconv.Itoa(index)
+	_, err := mgm.Coll(rendition).UpdateOne(mgm.Ctx(), bson.M{"_id": rendition.ID}, bson.M{
+		operator.Set: bson.M{field: segment, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// SetInitSegment records the initialization segment of a fragmented MP4 rendition
+func (b *moviesRepo) SetInitSegment(rendition *movies.VideoRendition, key string) error {
+	_, err := mgm.Coll(rendition).UpdateOne(mgm.Ctx(), bson.M{"_id": rendition.ID}, bson.M{
+		operator.Set: bson.M{"init_key": key, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+// DeleteRendition deletes the rendition, its segment files are left for the media GC
+func (b *moviesRepo) DeleteRendition(rendition *movies.VideoRendition) error {
+	return mgm.Coll(rendition).Delete(rendition)
+}
+
+// DeleteMovie deletes the movie if it was not modified since it was loaded, along with the watchlist
+// entries and playback progress referencing it
+func (b *moviesRepo) DeleteMovie(movie *movies.Movie) error {
+	res, err := mgm.Coll(movie).DeleteOne(mgm.Ctx(), versionFilter(movie.ID, movie.UpdatedAt))
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return ErrPreconditionFailed
+	}
+	if _, err = mgm.Coll(&movies.WatchlistEntry{}).DeleteMany(mgm.Ctx(), bson.M{"movie_id": movie.ID}); err != nil {
+		return err
+	}
+	if _, err = mgm.Coll(&movies.PlaybackProgress{}).DeleteMany(mgm.Ctx(), bson.M{"movie_id": movie.ID}); err != nil {
+		return err
+	}
+	_, err = mgm.Coll(&movies.MovieCollection{}).UpdateMany(mgm.Ctx(), bson.M{"movie_ids": movie.ID}, bson.M{
+		operator.Pull: bson.M{"movie_ids": movie.ID},
+	})
+	if err != nil {
+		return err
+	}
+	return deleteRenditions(movie)
+}
+
+// deleteRenditions deletes the renditions of a deleted movie, so the media GC collects their segments
+func deleteRenditions(movie *movies.Movie) error {
+	_, err := mgm.Coll(&movies.VideoRendition{}).DeleteMany(mgm.Ctx(), bson.M{"movie_id": movie.ID})
+	return err
+}
+
 func (b *moviesRepo) AddToWatchedList(watchEntry *movies.WatchedMovieEntry) error {
 
 	filter := bson.D{
-		{"$and",
-			bson.A{
-				bson.D{{"user_id", bson.D{{"$eq", watchEntry.UserId}}}},
-				bson.D{{"movie_id", bson.D{{"$eq", watchEntry.MovieID}}}},
-			}},
+		{Key: "$and", Value: bson.A{
+			bson.D{{Key: "user_id", Value: bson.D{{Key: "$eq", Value: watchEntry.UserId}}}},
+			bson.D{{Key: "movie_id", Value: bson.D{{Key: "$eq", Value: watchEntry.MovieID}}}},
+		}},
 	}
 	err := mgm.Coll(watchEntry).First(filter, watchEntry)
 	if err != nil {
@@ -53,11 +713,10 @@ func (b *moviesRepo) AddToWatchedList(watchEntry *movies.WatchedMovieEntry) erro
 func (b *moviesRepo) DidWatchMovie(movie *movies.Movie, user *users.User) (bool, error) {
 	watchEntry := &movies.WatchedMovieEntry{}
 	filter := bson.D{
-		{"$and",
-			bson.A{
-				bson.D{{"user_id", bson.D{{"$eq", user.ID}}}},
-				bson.D{{"movie_id", bson.D{{"$eq", movie.ID}}}},
-			}},
+		{Key: "$and", Value: bson.A{
+			bson.D{{Key: "user_id", Value: bson.D{{Key: "$eq", Value: user.ID}}}},
+			bson.D{{Key: "movie_id", Value: bson.D{{Key: "$eq", Value: movie.ID}}}},
+		}},
 	}
 	err := mgm.Coll(watchEntry).First(filter, watchEntry)
 	if err != nil {
@@ -70,14 +729,269 @@ func (b *moviesRepo) DidWatchMovie(movie *movies.Movie, user *users.User) (bool,
 	return true, nil
 }
 
+// FindProgress returns the playback progress of the user on the movie, or nil if there is none.
+// Of duplicate entries stored before the unique index existed, the last reported one is returned.
+func (b *moviesRepo) FindProgress(movieID primitive.ObjectID, userID primitive.ObjectID) (*movies.PlaybackProgress, error) {
+	progress := &movies.PlaybackProgress{}
+	err := mgm.Coll(progress).First(
+		bson.M{"movie_id": movieID, "user_id": userID},
+		progress,
+		options.FindOne().SetSort(bson.M{"updated_at": -1}),
+	)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return progress, nil
+}
+
+// SaveProgress creates or updates the playback progress of a user on a movie. The progress is
+// upserted by movie and user, so reports sent together when playback starts create a single entry.
+func (b *moviesRepo) SaveProgress(progress *movies.PlaybackProgress) error {
+	progress.UpdatedAt = time.Now().UTC()
+	filter := bson.M{"movie_id": progress.MovieID, "user_id": progress.UserID}
+	update := bson.M{
+		operator.Set: bson.M{
+			"position":   progress.Position,
+			"duration":   progress.Duration,
+			"percent":    progress.Percent,
+			"completed":  progress.Completed,
+			"dismissed":  progress.Dismissed,
+			"updated_at": progress.UpdatedAt,
+		},
+		operator.SetOnInsert: bson.M{"created_at": progress.UpdatedAt},
+	}
+	coll := mgm.Coll(progress)
+	res, err := coll.UpdateOne(mgm.Ctx(), filter, update, options.Update().SetUpsert(true))
+	// A concurrent report inserted the entry first, this one updates it
+	if mongo.IsDuplicateKeyError(err) {
+		res, err = coll.UpdateOne(mgm.Ctx(), filter, update)
+	}
+	if err != nil {
+		return err
+	}
+	if id, ok := res.UpsertedID.(primitive.ObjectID); ok {
+		progress.ID = id
+		progress.CreatedAt = progress.UpdatedAt
+	}
+	return nil
+}
+
+// ListInProgress returns the movies the user started and did not finish since the given time,
+// most recently played first, leaving out dismissed ones
+func (b *moviesRepo) ListInProgress(userID primitive.ObjectID, since time.Time, skip int64, limit int64) ([]movies.PlaybackProgress, error) {
+	found := []movies.PlaybackProgress{}
+	err := mgm.Coll(&movies.PlaybackProgress{}).SimpleFind(
+		&found,
+		bson.M{
+			"user_id":    userID,
+			"completed":  false,
+			"dismissed":  bson.M{operator.Ne: true},
+			"position":   bson.M{operator.Gt: 0},
+			"updated_at": bson.M{operator.Gte: since},
+		},
+		options.Find().SetSort(bson.M{"updated_at": -1}).SetSkip(skip).SetLimit(limit),
+	)
+	return found, err
+}
+
+// DismissProgress hides the movie from the "continue watching" row of the user
+func (b *moviesRepo) DismissProgress(movieID primitive.ObjectID, userID primitive.ObjectID) error {
+	res, err := mgm.Coll(&movies.PlaybackProgress{}).UpdateMany(mgm.Ctx(), bson.M{"movie_id": movieID, "user_id": userID}, bson.M{
+		operator.Set: bson.M{"dismissed": true},
+	})
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// ListWatchlist returns the watchlist of the user, in its order
+func (b *moviesRepo) ListWatchlist(userID primitive.ObjectID) ([]movies.WatchlistEntry, error) {
+	entries := []movies.WatchlistEntry{}
+	err := mgm.Coll(&movies.WatchlistEntry{}).SimpleFind(
+		&entries,
+		bson.M{"user_id": userID},
+		options.Find().SetSort(bson.D{{Key: "position", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	return entries, err
+}
+
+// AddToWatchlist appends the movie to the watchlist of the user, unless it is already in it.
+// The entry is upserted, so concurrent requests adding the same movie create a single entry.
+func (b *moviesRepo) AddToWatchlist(movieID primitive.ObjectID, userID primitive.ObjectID) error {
+	coll := mgm.Coll(&movies.WatchlistEntry{})
+	last := &movies.WatchlistEntry{Position: -1}
+	err := coll.First(bson.M{"user_id": userID}, last, options.FindOne().SetSort(bson.M{"position": -1}))
+	if err != nil && err != mongo.ErrNoDocuments {
+		return err
+	}
+	now := time.Now().UTC()
+	_, err = coll.UpdateOne(
+		mgm.Ctx(),
+		bson.M{"user_id": userID, "movie_id": movieID},
+		bson.M{operator.SetOnInsert: bson.M{"position": last.Position + 1, "created_at": now, "updated_at": now}},
+		options.Update().SetUpsert(true),
+	)
+	// Losing the race to insert the entry to a concurrent request means it is in the watchlist
+	if mongo.IsDuplicateKeyError(err) {
+		return nil
+	}
+	return err
+}
+
+// RemoveFromWatchlist removes the movie from the watchlist of the user, along with the duplicate
+// entries left by requests racing to add it before the unique index existed
+func (b *moviesRepo) RemoveFromWatchlist(movieID primitive.ObjectID, userID primitive.ObjectID) error {
+	res, err := mgm.Coll(&movies.WatchlistEntry{}).DeleteMany(mgm.Ctx(), bson.M{"user_id": userID, "movie_id": movieID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// ReorderWatchlist orders the watchlist of the user like movieIDs
+func (b *moviesRepo) ReorderWatchlist(userID primitive.ObjectID, movieIDs []primitive.ObjectID) error {
+	coll := mgm.Coll(&movies.WatchlistEntry{})
+	for position, movieID := range movieIDs {
+		_, err := coll.UpdateOne(mgm.Ctx(), bson.M{"user_id": userID, "movie_id": movieID}, bson.M{
+			operator.Set: bson.M{"position": position, "updated_at": time.Now().UTC()},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// InWatchlist returns which of the movies are in the watchlist of the user
+func (b *moviesRepo) InWatchlist(userID primitive.ObjectID, movieIDs []primitive.ObjectID) (map[primitive.ObjectID]bool, error) {
+	entries := []movies.WatchlistEntry{}
+	err := mgm.Coll(&movies.WatchlistEntry{}).SimpleFind(
+		&entries,
+		bson.M{"user_id": userID, "movie_id": bson.M{operator.In: movieIDs}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	found := map[primitive.ObjectID]bool{}
+	for _, entry := range entries {
+		found[entry.MovieID] = true
+	}
+	return found, nil
+}
+
+// replaceInCollections puts the survivor in place of the duplicate in collections,
+// dropping the duplicate from those already listing the survivor
+func replaceInCollections(survivor *movies.Movie, duplicate *movies.Movie) error {
+	coll := mgm.Coll(&movies.MovieCollection{})
+	_, err := coll.UpdateMany(
+		mgm.Ctx(),
+		bson.M{operator.And: bson.A{
+			bson.M{"movie_ids": duplicate.ID},
+			bson.M{"movie_ids": bson.M{operator.Ne: survivor.ID}},
+		}},
+		bson.M{operator.Set: bson.M{"movie_ids.$[movie]": survivor.ID}},
+		options.Update().SetArrayFilters(options.ArrayFilters{Filters: bson.A{bson.M{"movie": duplicate.ID}}}),
+	)
+	if err != nil {
+		return err
+	}
+	_, err = coll.UpdateMany(mgm.Ctx(), bson.M{"movie_ids": duplicate.ID}, bson.M{
+		operator.Pull: bson.M{"movie_ids": duplicate.ID},
+	})
+	return err
+}
+
+// SaveCollection creates or updates a collection
+func (b *moviesRepo) SaveCollection(collection *movies.MovieCollection) error {
+	if collection.ID.IsZero() {
+		return mgm.Coll(collection).Create(collection)
+	}
+	return mgm.Coll(collection).Update(collection)
+}
+
+// FindCollection returns the collection with the given ID, or nil if there is none
+func (b *moviesRepo) FindCollection(id primitive.ObjectID) (*movies.MovieCollection, error) {
+	return findCollection(bson.M{"_id": id})
+}
+
+// FindSharedCollection returns the collection with the given share token, or nil if there is none
+func (b *moviesRepo) FindSharedCollection(token string) (*movies.MovieCollection, error) {
+	return findCollection(bson.M{"share_token": token})
+}
+
+func findCollection(filter bson.M) (*movies.MovieCollection, error) {
+	collection := &movies.MovieCollection{}
+	err := mgm.Coll(collection).First(filter, collection)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return collection, nil
+}
+
+// DeleteCollection deletes a collection
+func (b *moviesRepo) DeleteCollection(collection *movies.MovieCollection) error {
+	return mgm.Coll(collection).Delete(collection)
+}
+
+// ListCollections returns the collections of the user, most recently updated first
+func (b *moviesRepo) ListCollections(ownerID primitive.ObjectID) ([]movies.CollectionSummary, error) {
+	return listCollections(bson.M{"owner_id": ownerID}, 0, 0)
+}
+
+// ListPublicCollections returns a page of the public collections, most recently updated first
+func (b *moviesRepo) ListPublicCollections(skip int64, limit int64) ([]movies.CollectionSummary, error) {
+	return listCollections(bson.M{"visibility": movies.VisibilityPublic}, skip, limit)
+}
+
+func listCollections(filter bson.M, skip int64, limit int64) ([]movies.CollectionSummary, error) {
+	usersCollName := mgm.Coll(&users.User{}).Name()
+
+	stages := []interface{}{
+		bson.M{operator.Match: filter},
+		bson.M{operator.Sort: bson.D{{Key: "updated_at", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+	if skip > 0 {
+		stages = append(stages, bson.M{operator.Skip: skip})
+	}
+	if limit > 0 {
+		stages = append(stages, bson.M{operator.Limit: limit})
+	}
+	stages = append(stages,
+		builder.Lookup(usersCollName, "owner_id", "_id", "owner"),
+		bson.M{operator.Set: bson.M{
+			"owner_name": bson.M{operator.First: "$owner.name"},
+		}},
+		bson.M{operator.Unset: "owner"},
+	)
+
+	results := []movies.CollectionSummary{}
+	err := mgm.Coll(&movies.MovieCollection{}).SimpleAggregate(&results, stages...)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
 func (b *moviesRepo) ReviewMovie(reviewEntry *movies.ReviewMovieEntry) error {
 
 	filter := bson.D{
-		{"$and",
-			bson.A{
-				bson.D{{"user_id", bson.D{{"$eq", reviewEntry.UserId}}}},
-				bson.D{{"movie_id", bson.D{{"$eq", reviewEntry.MovieID}}}},
-			}},
+		{Key: "$and", Value: bson.A{
+			bson.D{{Key: "user_id", Value: bson.D{{Key: "$eq", Value: reviewEntry.UserId}}}},
+			bson.D{{Key: "movie_id", Value: bson.D{{Key: "$eq", Value: reviewEntry.MovieID}}}},
+		}},
 	}
 	foundEntry := &movies.ReviewMovieEntry{}
 	err := mgm.Coll(foundEntry).First(filter, foundEntry)
@@ -97,3 +1011,229 @@ func (b *moviesRepo) ReviewMovie(reviewEntry *movies.ReviewMovieEntry) error {
 	return nil
 
 }
+
+// SaveMovieWithRevision saves the movie like SaveMovie, recording its changes since before as a new revision
+func (b *moviesRepo) SaveMovieWithRevision(before *movies.Movie, movie *movies.Movie, user *users.User) error {
+	beforeDoc, err := toDocument(before)
+	if err != nil {
+		return err
+	}
+	afterDoc, err := toDocument(movie)
+	if err != nil {
+		return err
+	}
+	return b.writeRevision(movie.ID, user, diffDocuments(beforeDoc, afterDoc), 0, func() error {
+		return b.SaveMovie(movie)
+	})
+}
+
+// UpdateMovieWithRevision updates the movie like UpdateMovie, recording its changes since before as a new revision.
+// Empty fields are left as they were, so they are not part of the changes either.
+func (b *moviesRepo) UpdateMovieWithRevision(before *movies.Movie, movie *movies.Movie, user *users.User) error {
+	beforeDoc, err := toDocument(before)
+	if err != nil {
+		return err
+	}
+	setDoc, err := toDocument(movie)
+	if err != nil {
+		return err
+	}
+	afterDoc := bson.M{}
+	for field, value := range beforeDoc {
+		afterDoc[field] = value
+	}
+	for field, value := range setDoc {
+		afterDoc[field] = value
+	}
+	return b.writeRevision(movie.ID, user, diffDocuments(beforeDoc, afterDoc), 0, func() error {
+		return b.UpdateMovie(movie)
+	})
+}
+
+// writeRevision records the changes as the next revision of the movie, then applies them with write.
+// The revision is recorded first and deleted again if the write fails, so no change is left without
+// its revision; at worst, a crash in between leaves a revision of a change that was not applied.
+// The numbers of revisions deleted that way are not reused.
+func (b *moviesRepo) writeRevision(movieID primitive.ObjectID, user *users.User, changes []movies.FieldChange, revertOf int, write func() error) error {
+	if len(changes) == 0 {
+		return write()
+	}
+	rev, err := b.nextRev(movieID)
+	if err != nil {
+		return err
+	}
+	revision := &movies.MovieRevision{
+		MovieID:   movieID,
+		Rev:       rev,
+		ChangedBy: user.ID,
+		Changes:   changes,
+		RevertOf:  revertOf,
+	}
+	if err := mgm.Coll(revision).Create(revision); err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		if deleteErr := mgm.Coll(revision).Delete(revision); deleteErr != nil {
+			log.Printf("unable to delete revision %d of movie %s after a failed write: %v", rev, movieID.Hex(), deleteErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// revisionCountersCollName is the collection holding the last revision number of each movie
+const revisionCountersCollName = "movie_revision_counters"
+
+// nextRev allocates the next revision number of the movie. Numbers come from a per-movie counter
+// incremented atomically, so concurrent edits never get the same one.
+func (b *moviesRepo) nextRev(movieID primitive.ObjectID) (int, error) {
+	coll := mgm.CollectionByName(revisionCountersCollName)
+	for {
+		counter := struct {
+			Rev int `bson:"rev"`
+		}{}
+		err := coll.FindOneAndUpdate(
+			mgm.Ctx(),
+			bson.M{"_id": movieID},
+			bson.M{operator.Inc: bson.M{"rev": 1}},
+			options.FindOneAndUpdate().SetReturnDocument(options.After),
+		).Decode(&counter)
+		if err != mongo.ErrNoDocuments {
+			return counter.Rev, err
+		}
+
+		// The counter of movies revised before counters were kept starts from their last revision
+		last := &movies.MovieRevision{}
+		err = mgm.Coll(last).First(bson.M{"movie_id": movieID}, last, options.FindOne().SetSort(bson.M{"rev": -1}))
+		if err != nil && err != mongo.ErrNoDocuments {
+			return 0, err
+		}
+		_, err = coll.UpdateOne(
+			mgm.Ctx(),
+			bson.M{"_id": movieID},
+			bson.M{operator.Max: bson.M{"rev": last.Rev}},
+			options.Update().SetUpsert(true),
+		)
+		// A concurrent request creating the counter first is fine, it is incremented on the next try
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return 0, err
+		}
+	}
+}
+
+func (b *moviesRepo) ListRevisions(movie *movies.Movie) ([]movies.MovieRevisionInfo, error) {
+	usersCollName := mgm.Coll(&users.User{}).Name()
+
+	results := []movies.MovieRevisionInfo{}
+	err := mgm.Coll(&movies.MovieRevision{}).SimpleAggregate(
+		&results,
+		bson.M{operator.Match: bson.M{"movie_id": movie.ID}},
+		bson.M{operator.Sort: bson.M{"rev": -1}},
+		builder.Lookup(usersCollName, "changed_by", "_id", "user"),
+		bson.M{operator.Set: bson.M{
+			"changed_by_name":  bson.M{operator.First: "$user.name"},
+			"changed_by_email": bson.M{operator.First: "$user.email"},
+		}},
+		bson.M{operator.Unset: "user"},
+	)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+func (b *moviesRepo) GetRevision(movie *movies.Movie, rev int) (*movies.MovieRevision, error) {
+	revision := &movies.MovieRevision{}
+	err := mgm.Coll(revision).First(bson.M{"movie_id": movie.ID, "rev": rev}, revision)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrRevisionNotFound
+		}
+		return nil, err
+	}
+	return revision, nil
+}
+
+// RevertRevision undoes the changes of the given revision by restoring their old values,
+// recording the revert itself as a new revision.
+func (b *moviesRepo) RevertRevision(movie *movies.Movie, revision *movies.MovieRevision, user *users.User) error {
+	beforeDoc, err := toDocument(movie)
+	if err != nil {
+		return err
+	}
+	set := bson.M{"updated_at": time.Now().UTC()}
+	unset := bson.M{}
+	afterDoc := bson.M{}
+	for field, value := range beforeDoc {
+		afterDoc[field] = value
+	}
+	for _, change := range revision.Changes {
+		if change.Old == nil {
+			unset[change.Field] = ""
+			delete(afterDoc, change.Field)
+			continue
+		}
+		set[change.Field] = change.Old
+		afterDoc[change.Field] = change.Old
+		if change.Field == "name" {
+			if name, ok := change.Old.(string); ok {
+				set["normalized_name"] = movies.NormalizeTitle(name)
+			}
+		}
+	}
+	update := bson.M{operator.Set: set}
+	if len(unset) > 0 {
+		update[operator.Unset] = unset
+	}
+
+	coll := mgm.Coll(movie)
+	return b.writeRevision(movie.ID, user, diffDocuments(beforeDoc, afterDoc), revision.Rev, func() error {
+		res, err := coll.UpdateOne(mgm.Ctx(), versionFilter(movie.ID, movie.UpdatedAt), update)
+		if err != nil {
+			return err
+		}
+		if res.MatchedCount == 0 {
+			return ErrPreconditionFailed
+		}
+		return coll.FindByID(movie.ID, movie)
+	})
+}
+
+// diffDocuments compares the stored representation of two movies field by field
+func diffDocuments(beforeDoc bson.M, afterDoc bson.M) []movies.FieldChange {
+	fields := map[string]bool{}
+	for field := range beforeDoc {
+		fields[field] = true
+	}
+	for field := range afterDoc {
+		fields[field] = true
+	}
+
+	var changes []movies.FieldChange
+	for field := range fields {
+		if untrackedFields[field] || reflect.DeepEqual(beforeDoc[field], afterDoc[field]) {
+			continue
+		}
+		changes = append(changes, movies.FieldChange{
+			Field: field,
+			Old:   beforeDoc[field],
+			New:   afterDoc[field],
+		})
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes
+}
+
+func toDocument(movie *movies.Movie) (bson.M, error) {
+	raw, err := bson.Marshal(movie)
+	if err != nil {
+		return nil, err
+	}
+	doc := bson.M{}
+	if err := bson.Unmarshal(raw, &doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
@@ -1,20 +1,32 @@
 package usersrepo
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"github.com/kamva/mgm/v3"
 	"go-app/definitions/users"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 	"golang.org/x/crypto/bcrypt"
+	"time"
 )
 
 // Repo Interface
 type Repo interface {
 	CreateUser(user *users.User) (*users.User, error)
 	CheckPassword(user *users.LoginInfoInput) error
+	UpdatePreferences(user *users.User) error
+	FindByEmail(email string) (*users.User, error)
+	FindMediaAccess(id primitive.ObjectID) (*users.User, error)
+	RotateMediaSalt(user *users.User) error
 }
 
+// ErrUserNotFound is returned when no user has the requested email
+var ErrUserNotFound = errors.New("user does not exist")
+
 type usersRepo struct {
 	db *mongo.Client
 }
@@ -52,3 +64,55 @@ func (b *usersRepo) CheckPassword(input *users.LoginInfoInput) (err error) {
 
 	return nil
 }
+
+// UpdatePreferences saves the user's preferences without going through the saving hooks,
+// which would hash the password again
+func (b *usersRepo) UpdatePreferences(user *users.User) error {
+	_, err := mgm.Coll(user).UpdateOne(mgm.Ctx(), bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{"language": user.Language, "updated_at": time.Now().UTC()},
+	})
+	return err
+}
+
+func (b *usersRepo) FindByEmail(email string) (*users.User, error) {
+	user := &users.User{}
+	err := mgm.Coll(user).First(bson.M{"email": email}, user)
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// FindMediaAccess returns the user with only what media URLs are validated with loaded:
+// the salt they are signed with and the role
+func (b *usersRepo) FindMediaAccess(id primitive.ObjectID) (*users.User, error) {
+	user := &users.User{}
+	err := mgm.Coll(user).First(bson.M{"_id": id}, user, options.FindOne().SetProjection(bson.M{"media_salt": 1, "role": 1}))
+	if err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return user, nil
+}
+
+// RotateMediaSalt replaces the media salt of the user, revoking the media URLs signed with the previous one
+func (b *usersRepo) RotateMediaSalt(user *users.User) error {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return err
+	}
+	salt := hex.EncodeToString(random)
+	_, err := mgm.Coll(user).UpdateOne(mgm.Ctx(), bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{"media_salt": salt, "updated_at": time.Now().UTC()},
+	})
+	if err != nil {
+		return err
+	}
+	user.MediaSalt = salt
+	return nil
+}
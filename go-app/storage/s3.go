@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"context"
+	"go-app/configs"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+)
+
+// noSuchKey is the S3 error code of missing objects
+const noSuchKey = "NoSuchKey"
+
+type s3Storage struct {
+	client *minio.Client
+	bucket string
+	prefix string
+}
+
+// NewS3Storage instantiates a storage keeping blobs in an S3 compatible bucket, such as MinIO,
+// creating the bucket if it does not exist yet
+func NewS3Storage(config configs.StorageConfig) (Storage, error) {
+	client, err := minio.New(config.Endpoint, &minio.Options{
+		Creds:  credentials.NewStaticV4(config.AccessKey, config.SecretKey, ""),
+		Secure: config.UseSSL,
+		Region: config.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx := context.Background()
+	exists, err := client.BucketExists(ctx, config.Bucket)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		err = client.MakeBucket(ctx, config.Bucket, minio.MakeBucketOptions{Region: config.Region})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &s3Storage{client: client, bucket: config.Bucket, prefix: config.Prefix}, nil
+}
+
+// object maps a key to the name of its object in the bucket
+func (b *s3Storage) object(key string) (string, error) {
+	if key == "" || path.Clean("/"+key) != "/"+key {
+		return "", ErrInvalidKey
+	}
+	return path.Join(b.prefix, key), nil
+}
+
+func (b *s3Storage) Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error {
+	object, err := b.object(key)
+	if err != nil {
+		return err
+	}
+	_, err = b.client.PutObject(ctx, b.bucket, object, r, size, minio.PutObjectOptions{ContentType: contentType})
+	return err
+}
+
+// Open returns the object, which is fetched lazily with range requests as it is read
+func (b *s3Storage) Open(ctx context.Context, key string) (Blob, error) {
+	object, err := b.object(key)
+	if err != nil {
+		return nil, err
+	}
+	obj, err := b.client.GetObject(ctx, b.bucket, object, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	// Errors only surface once the object is accessed
+	if _, err = obj.Stat(); err != nil {
+		obj.Close()
+		if minio.ToErrorResponse(err).Code == noSuchKey {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return obj, nil
+}
+
+func (b *s3Storage) Delete(ctx context.Context, key string) error {
+	object, err := b.object(key)
+	if err != nil {
+		return err
+	}
+	return b.client.RemoveObject(ctx, b.bucket, object, minio.RemoveObjectOptions{})
+}
+
+func (b *s3Storage) PresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error) {
+	object, err := b.object(key)
+	if err != nil {
+		return "", err
+	}
+	u, err := b.client.PresignedGetObject(ctx, b.bucket, object, expiry, nil)
+	if err != nil {
+		return "", err
+	}
+	return u.String(), nil
+}
+
+func (b *s3Storage) List(ctx context.Context, prefix string) ([]BlobInfo, error) {
+	root := b.prefix
+	if root != "" && !strings.HasSuffix(root, "/") {
+		root += "/"
+	}
+	blobs := []BlobInfo{}
+	for object := range b.client.ListObjects(ctx, b.bucket, minio.ListObjectsOptions{Prefix: root + prefix, Recursive: true}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		blobs = append(blobs, BlobInfo{
+			Key:     strings.TrimPrefix(object.Key, root),
+			Size:    object.Size,
+			ModTime: object.LastModified,
+		})
+	}
+	return blobs, nil
+}
@@ -0,0 +1,71 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-app/configs"
+	"io"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no blob is stored under a key
+	ErrNotFound = errors.New("blob not found")
+	// ErrPresignNotSupported is returned by backends that cannot hand out download URLs
+	ErrPresignNotSupported = errors.New("storage backend does not support presigned URLs")
+	// ErrInvalidKey is returned for keys escaping the storage root
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// Key prefixes of the media files stored by the app. Other keys are left alone, the storage
+// root of the local backend may be shared with files the app does not own.
+const (
+	CoversPrefix    = "covers/"
+	VideosPrefix    = "videos/"
+	SubtitlesPrefix = "subtitles/"
+	StreamsPrefix   = "streams/"
+)
+
+// MediaPrefixes lists the key prefixes of the media files stored by the app
+var MediaPrefixes = []string{CoversPrefix, VideosPrefix, SubtitlesPrefix, StreamsPrefix}
+
+// Blob is an opened blob, seekable so it can be served with range requests
+type Blob interface {
+	io.ReadSeeker
+	io.Closer
+}
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Key     string
+	Size    int64
+	ModTime time.Time
+}
+
+// Storage stores media files as blobs addressed by slash separated keys
+type Storage interface {
+	// Put stores the blob, replacing any blob with the same key
+	Put(ctx context.Context, key string, r io.Reader, size int64, contentType string) error
+	// Open returns the blob stored under the key, or ErrNotFound
+	Open(ctx context.Context, key string) (Blob, error)
+	// Delete removes the blob, deleting a missing blob is not an error
+	Delete(ctx context.Context, key string) error
+	// PresignedURL returns a URL the blob can be downloaded from without credentials
+	// until it expires, or ErrPresignNotSupported
+	PresignedURL(ctx context.Context, key string, expiry time.Duration) (string, error)
+	// List returns the blobs whose key starts with prefix
+	List(ctx context.Context, prefix string) ([]BlobInfo, error)
+}
+
+// New instantiates the storage backend selected in the config
+func New(config configs.StorageConfig) (Storage, error) {
+	switch config.Backend {
+	case configs.StorageLocal:
+		return NewLocalStorage(config.LocalDir)
+	case configs.StorageS3:
+		return NewS3Storage(config)
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.Backend)
+	}
+}
@@ -0,0 +1,207 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"go-app/configs"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// The S3 backend is tested against the bucket of a local MinIO when its endpoint is set, i.e.
+// docker-compose up -d minio && STORAGE_TEST_S3_ENDPOINT=localhost:9000 go test ./storage
+func newTestS3Storage(t *testing.T) Storage {
+	endpoint := os.Getenv("STORAGE_TEST_S3_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("STORAGE_TEST_S3_ENDPOINT is not set")
+	}
+	store, err := NewS3Storage(configs.StorageConfig{
+		Backend:   configs.StorageS3,
+		Endpoint:  endpoint,
+		AccessKey: getTestEnv("STORAGE_TEST_S3_ACCESS_KEY", "minioadmin"),
+		SecretKey: getTestEnv("STORAGE_TEST_S3_SECRET_KEY", "minioadmin"),
+		Region:    "us-east-1",
+		Bucket:    getTestEnv("STORAGE_TEST_S3_BUCKET", "go-app-test"),
+		// Each run gets its own prefix, so runs never see each other's blobs
+		Prefix: "test-" + strconv.FormatInt(time.Now().UnixNano(), 36) + "/",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func getTestEnv(name string, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+func TestLocalStorage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewLocalStorage(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testStorage(t, store)
+
+	if _, err := store.PresignedURL(context.Background(), "covers/a.jpg", time.Minute); err != ErrPresignNotSupported {
+		t.Fatalf("got %v, want %v", err, ErrPresignNotSupported)
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	store := newTestS3Storage(t)
+	testStorage(t, store)
+
+	ctx := context.Background()
+	if err := store.Put(ctx, "covers/presigned.txt", strings.NewReader("presigned"), 9, "text/plain"); err != nil {
+		t.Fatal(err)
+	}
+	defer store.Delete(ctx, "covers/presigned.txt")
+	url, err := store.PresignedURL(ctx, "covers/presigned.txt", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, _ := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "presigned" {
+		t.Fatalf("presigned URL served %d %q", res.StatusCode, body)
+	}
+}
+
+// testStorage checks the behavior every backend must have
+func testStorage(t *testing.T, store Storage) {
+	ctx := context.Background()
+	blobs := map[string]string{
+		"covers/a-1.jpg":       "cover",
+		"covers/a-1-thumb.jpg": "thumb",
+		"videos/a-1.mp4":       "video",
+	}
+	for key, data := range blobs {
+		if err := store.Put(ctx, key, strings.NewReader(data), int64(len(data)), "application/octet-stream"); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+	defer func() {
+		for key := range blobs {
+			_ = store.Delete(ctx, key)
+		}
+	}()
+
+	t.Run("open", func(t *testing.T) {
+		tests := []struct {
+			key  string
+			want string
+			err  error
+		}{
+			{"covers/a-1.jpg", "cover", nil},
+			{"videos/a-1.mp4", "video", nil},
+			{"covers/missing.jpg", "", ErrNotFound},
+			{"../escape", "", ErrInvalidKey},
+			{"", "", ErrInvalidKey},
+		}
+		for _, test := range tests {
+			blob, err := store.Open(ctx, test.key)
+			if err != test.err {
+				t.Fatalf("open %q: got %v, want %v", test.key, err, test.err)
+			}
+			if err != nil {
+				continue
+			}
+			data, err := ioutil.ReadAll(blob)
+			blob.Close()
+			if err != nil || string(data) != test.want {
+				t.Fatalf("open %q: got %q, %v, want %q", test.key, data, err, test.want)
+			}
+		}
+	})
+
+	t.Run("seek", func(t *testing.T) {
+		blob, err := store.Open(ctx, "covers/a-1-thumb.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer blob.Close()
+		if _, err := blob.Seek(2, io.SeekStart); err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(blob)
+		if err != nil || string(data) != "umb" {
+			t.Fatalf("got %q, %v, want %q", data, err, "umb")
+		}
+	})
+
+	t.Run("replace", func(t *testing.T) {
+		key := "covers/a-1.jpg"
+		if err := store.Put(ctx, key, bytes.NewReader([]byte("new cover")), 9, "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+		blobs[key] = "new cover"
+		blob, err := store.Open(ctx, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer blob.Close()
+		if data, _ := ioutil.ReadAll(blob); string(data) != "new cover" {
+			t.Fatalf("got %q, want %q", data, "new cover")
+		}
+	})
+
+	t.Run("list", func(t *testing.T) {
+		tests := []struct {
+			prefix string
+			want   []string
+		}{
+			{"covers/", []string{"covers/a-1-thumb.jpg", "covers/a-1.jpg"}},
+			{"covers/a-1-", []string{"covers/a-1-thumb.jpg"}},
+			{"videos/", []string{"videos/a-1.mp4"}},
+			{"subtitles/", []string{}},
+		}
+		for _, test := range tests {
+			found, err := store.List(ctx, test.prefix)
+			if err != nil {
+				t.Fatalf("list %q: %v", test.prefix, err)
+			}
+			keys := []string{}
+			for _, blob := range found {
+				keys = append(keys, blob.Key)
+				if blob.Size != int64(len(blobs[blob.Key])) || blob.ModTime.IsZero() {
+					t.Fatalf("list %q: unexpected info %+v", test.prefix, blob)
+				}
+			}
+			sort.Strings(keys)
+			if strings.Join(keys, ",") != strings.Join(test.want, ",") {
+				t.Fatalf("list %q: got %v, want %v", test.prefix, keys, test.want)
+			}
+		}
+	})
+
+	t.Run("delete", func(t *testing.T) {
+		if err := store.Delete(ctx, "videos/a-1.mp4"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.Open(ctx, "videos/a-1.mp4"); err != ErrNotFound {
+			t.Fatalf("got %v, want %v", err, ErrNotFound)
+		}
+		if err := store.Delete(ctx, "videos/a-1.mp4"); err != nil {
+			t.Fatalf("deleting a missing blob: %v", err)
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package streaming
+
+import (
+	"encoding/xml"
+	"fmt"
+	"go-app/definitions/movies"
+	"math"
+)
+
+// dashTimescale is the number of timeline units per second, milliseconds
+const dashTimescale = 1000
+
+type mpd struct {
+	XMLName                   xml.Name  `xml:"MPD"`
+	Xmlns                     string    `xml:"xmlns,attr"`
+	Type                      string    `xml:"type,attr"`
+	Profiles                  string    `xml:"profiles,attr"`
+	MinBufferTime             string    `xml:"minBufferTime,attr"`
+	MediaPresentationDuration string    `xml:"mediaPresentationDuration,attr"`
+	Period                    mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	AdaptationSet mpdAdaptationSet `xml:"AdaptationSet"`
+}
+
+type mpdAdaptationSet struct {
+	MimeType         string              `xml:"mimeType,attr"`
+	SegmentAlignment bool                `xml:"segmentAlignment,attr"`
+	Representations  []mpdRepresentation `xml:"Representation"`
+}
+
+type mpdRepresentation struct {
+	ID          string         `xml:"id,attr"`
+	Bandwidth   int            `xml:"bandwidth,attr"`
+	Width       int            `xml:"width,attr"`
+	Height      int            `xml:"height,attr"`
+	Codecs      string         `xml:"codecs,attr,omitempty"`
+	SegmentList mpdSegmentList `xml:"SegmentList"`
+}
+
+type mpdSegmentList struct {
+	Timescale      int             `xml:"timescale,attr"`
+	Initialization mpdURL          `xml:"Initialization"`
+	Timeline       []mpdTimeline   `xml:"SegmentTimeline>S"`
+	SegmentURLs    []mpdSegmentURL `xml:"SegmentURL"`
+}
+
+type mpdURL struct {
+	SourceURL string `xml:"sourceURL,attr"`
+}
+
+type mpdTimeline struct {
+	Start    int64 `xml:"t,attr"`
+	Duration int64 `xml:"d,attr"`
+}
+
+type mpdSegmentURL struct {
+	Media string `xml:"media,attr"`
+}
+
+// DASHManifest returns the DASH manifest of the fragmented MP4 renditions, or nil if none of them is playable
+func DASHManifest(renditions []movies.VideoRendition, link Link) ([]byte, error) {
+	set := mpdAdaptationSet{MimeType: InitContentType, SegmentAlignment: true}
+	duration := 0.0
+	for i := range renditions {
+		rendition := &renditions[i]
+		segments := rendition.PlayableSegments()
+		if rendition.Container != movies.ContainerFMP4 || len(segments) == 0 {
+			continue
+		}
+		base := "renditions/" + rendition.Name + "/segments/"
+		list := mpdSegmentList{
+			Timescale:      dashTimescale,
+			Initialization: mpdURL{SourceURL: link(base + movies.InitSegmentName)},
+		}
+		var start int64
+		for j, segment := range segments {
+			units := int64(math.Round(segment.Duration * dashTimescale))
+			list.Timeline = append(list.Timeline, mpdTimeline{Start: start, Duration: units})
+			list.SegmentURLs = append(list.SegmentURLs, mpdSegmentURL{Media: link(base + rendition.SegmentName(j))})
+			start += units
+		}
+		duration = math.Max(duration, float64(start)/dashTimescale)
+		set.Representations = append(set.Representations, mpdRepresentation{
+			ID:          rendition.Name,
+			Bandwidth:   rendition.Bandwidth,
+			Width:       rendition.Width,
+			Height:      rendition.Height,
+			Codecs:      rendition.Codecs,
+			SegmentList: list,
+		})
+	}
+	if len(set.Representations) == 0 {
+		return nil, nil
+	}
+
+	manifest, err := xml.MarshalIndent(mpd{
+		Xmlns:                     "urn:mpeg:dash:schema:mpd:2011",
+		Type:                      "static",
+		Profiles:                  "urn:mpeg:dash:profile:isoff-main:2011",
+		MinBufferTime:             "PT2S",
+		MediaPresentationDuration: fmt.Sprintf("PT%sS", formatSeconds(duration)),
+		Period:                    mpdPeriod{AdaptationSet: set},
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), manifest...), nil
+}
@@ -0,0 +1,93 @@
+package streaming
+
+import (
+	"bytes"
+	"fmt"
+	"go-app/definitions/movies"
+	"math"
+	"strings"
+)
+
+// Manifest content types
+const (
+	HLSContentType  = "application/vnd.apple.mpegurl"
+	DASHContentType = "application/dash+xml"
+)
+
+// Segment content types
+const (
+	TSContentType   = "video/mp2t"
+	FMP4ContentType = "video/iso.segment"
+	InitContentType = "video/mp4"
+)
+
+// SegmentContentType returns the content type of a segment of the rendition
+func SegmentContentType(rendition *movies.VideoRendition, name string) string {
+	switch {
+	case name == movies.InitSegmentName:
+		return InitContentType
+	case rendition.Container == movies.ContainerFMP4:
+		return FMP4ContentType
+	default:
+		return TSContentType
+	}
+}
+
+// Link turns a path relative to the stream of the movie, i.e. renditions/720p/playlist.m3u8,
+// into the URL players fetch it from
+type Link func(path string) string
+
+// HLSMaster returns the HLS master playlist of the renditions.
+// Renditions without playable segments are left out.
+func HLSMaster(renditions []movies.VideoRendition, link Link) []byte {
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n#EXT-X-INDEPENDENT-SEGMENTS\n")
+	for i := range renditions {
+		rendition := &renditions[i]
+		if len(rendition.PlayableSegments()) == 0 {
+			continue
+		}
+		fmt.Fprintf(&buf, "#EXT-X-STREAM-INF:BANDWIDTH=%d,RESOLUTION=%dx%d",
+			rendition.Bandwidth, rendition.Width, rendition.Height)
+		if rendition.Codecs != "" {
+			fmt.Fprintf(&buf, `,CODECS="%s"`, rendition.Codecs)
+		}
+		fmt.Fprintf(&buf, "\n%s\n", link("renditions/"+rendition.Name+"/playlist.m3u8"))
+	}
+	return buf.Bytes()
+}
+
+// HLSPlaylist returns the HLS media playlist of the rendition
+func HLSPlaylist(rendition *movies.VideoRendition, link Link) []byte {
+	segments := rendition.PlayableSegments()
+	targetDuration := 0.0
+	for _, segment := range segments {
+		targetDuration = math.Max(targetDuration, segment.Duration)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("#EXTM3U\n")
+	if rendition.Container == movies.ContainerFMP4 {
+		// Fragmented MP4 segments need EXT-X-MAP, introduced by version 6
+		buf.WriteString("#EXT-X-VERSION:7\n")
+	} else {
+		buf.WriteString("#EXT-X-VERSION:3\n")
+	}
+	fmt.Fprintf(&buf, "#EXT-X-TARGETDURATION:%d\n", int(math.Ceil(targetDuration)))
+	buf.WriteString("#EXT-X-MEDIA-SEQUENCE:0\n#EXT-X-PLAYLIST-TYPE:VOD\n")
+	base := "renditions/" + rendition.Name + "/segments/"
+	if rendition.Container == movies.ContainerFMP4 {
+		fmt.Fprintf(&buf, "#EXT-X-MAP:URI=\"%s\"\n", link(base+movies.InitSegmentName))
+	}
+	for i, segment := range segments {
+		fmt.Fprintf(&buf, "#EXTINF:%s,\n%s\n", formatSeconds(segment.Duration), link(base+rendition.SegmentName(i)))
+	}
+	buf.WriteString("#EXT-X-ENDLIST\n")
+	return buf.Bytes()
+}
+
+// formatSeconds formats a duration in seconds with up to millisecond precision
+func formatSeconds(seconds float64) string {
+	formatted := strings.TrimRight(fmt.Sprintf("%.3f", seconds), "0")
+	return strings.TrimSuffix(formatted, ".")
+}